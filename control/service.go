@@ -0,0 +1,189 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"sort"
+	"time"
+)
+
+const (
+	BusName       = "io.github.unrud.JoystickMonitor"
+	ObjectPath    = "/io/github/unrud/JoystickMonitor"
+	InterfaceName = "io.github.unrud.JoystickMonitor"
+
+	// Continuous activity is reported at most once per interval
+	activityInterval = time.Second
+)
+
+type Command int
+
+const (
+	CommandPause Command = iota
+	CommandResume
+	CommandReportActivity
+)
+
+type Service struct {
+	bus   *dbus.Conn
+	props *prop.Properties
+
+	lastActivity time.Time
+
+	c chan Command
+	C <-chan Command
+}
+
+type methods struct {
+	c chan<- Command
+}
+
+func (m methods) Pause() *dbus.Error {
+	m.c <- CommandPause
+	return nil
+}
+
+func (m methods) Resume() *dbus.Error {
+	m.c <- CommandResume
+	return nil
+}
+
+func (m methods) ReportActivity() *dbus.Error {
+	m.c <- CommandReportActivity
+	return nil
+}
+
+func NewService() (*Service, error) {
+	bus, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	chanC := make(chan Command)
+	s := &Service{bus: bus, c: chanC, C: chanC}
+	if err := s.export(); err != nil {
+		bus.Close()
+		return nil, err
+	}
+	reply, err := bus.RequestName(BusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		bus.Close()
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		bus.Close()
+		return nil, fmt.Errorf("name %v already taken", BusName)
+	}
+	return s, nil
+}
+
+func (s *Service) export() error {
+	m := methods{s.c}
+	if err := s.bus.Export(m, ObjectPath, InterfaceName); err != nil {
+		return err
+	}
+	props, err := prop.Export(s.bus, ObjectPath, prop.Map{
+		InterfaceName: {
+			"Inhibited":    {Value: false, Emit: prop.EmitTrue},
+			"Paused":       {Value: false, Emit: prop.EmitTrue},
+			"Devices":      {Value: []string{}, Emit: prop.EmitTrue},
+			"LastActivity": {Value: int64(0), Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.props = props
+	node := &introspect.Node{
+		Name: ObjectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       InterfaceName,
+				Methods:    introspect.Methods(m),
+				Properties: props.Introspection(InterfaceName),
+				Signals: []introspect.Signal{
+					{Name: "ActivityDetected", Args: []introspect.Arg{{Name: "device", Type: "s"}}},
+					{Name: "DevicesChanged", Args: []introspect.Arg{{Name: "devices", Type: "as"}}},
+					{Name: "InhibitChanged", Args: []introspect.Arg{{Name: "inhibited", Type: "b"}}},
+				},
+			},
+		},
+	}
+	return s.bus.Export(introspect.NewIntrospectable(node), ObjectPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// Signals are only notifications, errors are ignored
+func (s *Service) emit(name string, values ...interface{}) {
+	s.bus.Emit(ObjectPath, InterfaceName+"."+name, values...)
+}
+
+func (s *Service) SetInhibited(inhibited bool) {
+	if s.props.GetMust(InterfaceName, "Inhibited") == inhibited {
+		return
+	}
+	s.props.SetMust(InterfaceName, "Inhibited", inhibited)
+	s.emit("InhibitChanged", inhibited)
+}
+
+func (s *Service) SetPaused(paused bool) {
+	s.props.SetMust(InterfaceName, "Paused", paused)
+}
+
+func (s *Service) SetDevices(devices []string) {
+	devices = append([]string{}, devices...)
+	sort.Strings(devices)
+	if equalStrings(s.props.GetMust(InterfaceName, "Devices").([]string), devices) {
+		return
+	}
+	s.props.SetMust(InterfaceName, "Devices", devices)
+	s.emit("DevicesChanged", devices)
+}
+
+// ActivityDetected updates LastActivity and emits ActivityDetected. Further
+// activity within activityInterval is dropped.
+func (s *Service) ActivityDetected(device string, t time.Time) {
+	if !s.lastActivity.IsZero() && t.Sub(s.lastActivity) < activityInterval {
+		return
+	}
+	s.lastActivity = t
+	s.props.SetMust(InterfaceName, "LastActivity", t.UnixMicro())
+	s.emit("ActivityDetected", device)
+}
+
+func (s *Service) Close() error {
+	return s.bus.Close()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
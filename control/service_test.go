@@ -0,0 +1,111 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package control_test
+
+import (
+	"github.com/godbus/dbus/v5"
+	"github.com/unrud/joystick-monitor/control"
+	"github.com/unrud/joystick-monitor/screensaver/screensavertest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const signalTimeout = 5 * time.Second
+
+func startService(t *testing.T) (*control.Service, *dbus.Conn) {
+	screensavertest.StartSessionBus(t)
+	service, err := control.NewService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return service, conn
+}
+
+func TestServiceMethods(t *testing.T) {
+	service, conn := startService(t)
+	object := conn.Object(control.BusName, control.ObjectPath)
+	for _, test := range []struct {
+		method   string
+		expected control.Command
+	}{
+		{"Pause", control.CommandPause},
+		{"Resume", control.CommandResume},
+		{"ReportActivity", control.CommandReportActivity},
+	} {
+		call := object.Go(control.InterfaceName+"."+test.method, 0, nil)
+		select {
+		case command := <-service.C:
+			if command != test.expected {
+				t.Errorf("%v: got command %v, expected %v", test.method, command, test.expected)
+			}
+		case <-time.After(signalTimeout):
+			t.Fatalf("%v: no command", test.method)
+		}
+		if err := (<-call.Done).Err; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := object.Call(control.InterfaceName+".Unknown", 0).Err; err == nil {
+		t.Error("unknown method accepted")
+	}
+}
+
+func TestServiceDevices(t *testing.T) {
+	service, conn := startService(t)
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface(control.InterfaceName),
+		dbus.WithMatchMember("DevicesChanged"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	expectSignal := func(expected []string) {
+		t.Helper()
+		select {
+		case signal := <-signals:
+			if devices, _ := signal.Body[0].([]string); !reflect.DeepEqual(devices, expected) {
+				t.Errorf("got devices %v, expected %v", signal.Body, expected)
+			}
+		case <-time.After(signalTimeout):
+			t.Fatalf("no signal for %v", expected)
+		}
+	}
+	service.SetDevices([]string{"Xbox Wireless Controller", "DualSense Wireless Controller"})
+	expectSignal([]string{"DualSense Wireless Controller", "Xbox Wireless Controller"})
+	// Unchanged devices in another order
+	service.SetDevices([]string{"DualSense Wireless Controller", "Xbox Wireless Controller"})
+	service.SetDevices(nil)
+	expectSignal([]string{})
+	value, err := conn.Object(control.BusName, control.ObjectPath).GetProperty(control.InterfaceName + ".Devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devices, _ := value.Value().([]string); len(devices) != 0 {
+		t.Errorf("got property %v", value)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/unrud/joystick-monitor/control"
+	"github.com/unrud/joystick-monitor/screensaver"
+	"log"
+	"time"
+)
+
+type InhibitController struct {
+	inhibitor screensaver.Inhibitor
+	service   *control.Service
+	timeout   time.Duration
+
+	timer     *time.Timer
+	inhibited bool
+	paused    bool
+	// Application of the current inhibit and its last activity
+	application         string
+	applicationActivity time.Time
+
+	// Timeout must be called after receiving from C
+	C <-chan time.Time
+}
+
+func NewInhibitController(inhibitor screensaver.Inhibitor, service *control.Service, timeout time.Duration) *InhibitController {
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	return &InhibitController{
+		inhibitor: inhibitor,
+		service:   service,
+		timeout:   timeout,
+		timer:     timer,
+		C:         timer.C,
+	}
+}
+
+func (c *InhibitController) Inhibited() bool {
+	return c.inhibited
+}
+
+func (c *InhibitController) Paused() bool {
+	return c.paused
+}
+
+// Activity inhibits the screen saver, application is the name of the
+// application that uses the device (empty if unknown). The inhibit is
+// reissued to update the reason if another application is active and the
+// application of the current inhibit was idle for the timeout.
+func (c *InhibitController) Activity(device, application string) {
+	now := time.Now()
+	if c.service != nil {
+		c.service.ActivityDetected(device, now)
+	}
+	if c.paused {
+		return
+	}
+	if c.inhibited {
+		if !c.timer.Stop() {
+			<-c.timer.C
+		}
+		if application == c.application {
+			c.applicationActivity = now
+		} else if application != "" && now.Sub(c.applicationActivity) >= c.timeout {
+			if err := c.inhibitor.Uninhibit(); err != nil {
+				log.Printf("uninhibit: %v\n", err)
+			}
+			c.inhibited = false
+		}
+	}
+	if !c.inhibited {
+		reason := ""
+		if application != "" {
+			reason = fmt.Sprintf("%v (gamepad)", application)
+		}
+		if err := c.inhibitor.Inhibit(reason); err != nil {
+			// Retried on the next activity
+			log.Printf("inhibit: %v\n", err)
+			if c.service != nil {
+				c.service.SetInhibited(false)
+			}
+			return
+		}
+		log.Println("inhibit")
+		c.inhibited = true
+		c.application = application
+		c.applicationActivity = now
+		if c.service != nil {
+			c.service.SetInhibited(true)
+		}
+	}
+	c.timer.Reset(c.timeout)
+}
+
+func (c *InhibitController) Timeout() {
+	c.uninhibit()
+}
+
+func (c *InhibitController) uninhibit() {
+	c.inhibited = false
+	if err := c.inhibitor.Uninhibit(); err != nil {
+		log.Printf("uninhibit: %v\n", err)
+	} else {
+		log.Println("uninhibit")
+	}
+	if c.service != nil {
+		c.service.SetInhibited(false)
+	}
+}
+
+func (c *InhibitController) Pause() {
+	if c.paused {
+		return
+	}
+	c.paused = true
+	log.Println("pause")
+	if c.inhibited {
+		if !c.timer.Stop() {
+			<-c.timer.C
+		}
+		c.uninhibit()
+	}
+	if c.service != nil {
+		c.service.SetPaused(true)
+	}
+}
+
+func (c *InhibitController) Resume() {
+	if !c.paused {
+		return
+	}
+	c.paused = false
+	log.Println("resume")
+	if c.service != nil {
+		c.service.SetPaused(false)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/godbus/dbus/v5"
+	"github.com/unrud/joystick-monitor/control"
+	"github.com/unrud/joystick-monitor/screensaver"
+	"github.com/unrud/joystick-monitor/screensaver/screensavertest"
+	"testing"
+	"time"
+)
+
+const testTimeout = 50 * time.Millisecond
+
+func newTestInhibitController(t *testing.T) (*InhibitController, *screensavertest.FakeService, *control.Service) {
+	bus := screensavertest.StartSessionBus(t)
+	fake := screensavertest.StartFakeScreenSaver(t, bus)
+	inhibitor, err := screensaver.NewScreensaver(appName, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { inhibitor.Close() })
+	service, err := control.NewService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return NewInhibitController(inhibitor, service, testTimeout), fake, service
+}
+
+func expectProperty(t *testing.T, name string, expected interface{}) {
+	t.Helper()
+	if value := getProperty(t, name); value != expected {
+		t.Errorf("property %v is %v, expected %v", name, value, expected)
+	}
+}
+
+func getProperty(t *testing.T, name string) interface{} {
+	t.Helper()
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	value, err := conn.Object(control.BusName, control.ObjectPath).GetProperty(control.InterfaceName + "." + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value.Value()
+}
+
+func expectNoTimeout(t *testing.T, c *InhibitController) {
+	t.Helper()
+	select {
+	case <-c.C:
+		t.Fatal("unexpected timeout")
+	case <-time.After(2 * testTimeout):
+	}
+}
+
+func TestInhibitController(t *testing.T) {
+	c, fake, _ := newTestInhibitController(t)
+	c.Activity("/dev/input/js0", "")
+	if !c.Inhibited() || fake.Inhibited() != 1 {
+		t.Fatal("not inhibited")
+	}
+	expectProperty(t, "Inhibited", true)
+	for i := 0; i < 3; i++ {
+		time.Sleep(testTimeout / 2)
+		c.Activity("/dev/input/js0", "")
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Fatalf("%d calls, expected 1", n)
+	}
+	<-c.C
+	c.Timeout()
+	if c.Inhibited() || fake.Inhibited() != 0 {
+		t.Fatal("not uninhibited")
+	}
+	expectProperty(t, "Inhibited", false)
+	expectNoTimeout(t, c)
+}
+
+func TestInhibitControllerPause(t *testing.T) {
+	c, fake, _ := newTestInhibitController(t)
+	c.Activity("/dev/input/js0", "")
+	c.Pause()
+	if c.Inhibited() || fake.Inhibited() != 0 {
+		t.Fatal("not uninhibited")
+	}
+	expectProperty(t, "Paused", true)
+	expectNoTimeout(t, c)
+	c.Activity("/dev/input/js0", "")
+	if c.Inhibited() || fake.Inhibited() != 0 {
+		t.Fatal("inhibited while paused")
+	}
+	expectNoTimeout(t, c)
+	c.Resume()
+	expectProperty(t, "Paused", false)
+	c.Activity("/dev/input/js0", "")
+	if !c.Inhibited() || fake.Inhibited() != 1 {
+		t.Fatal("not inhibited")
+	}
+}
+
+func TestInhibitControllerServiceError(t *testing.T) {
+	c, fake, _ := newTestInhibitController(t)
+	fake.SetError("org.freedesktop.DBus.Error.Failed")
+	c.Activity("/dev/input/js0", "")
+	if c.Inhibited() {
+		t.Fatal("failed inhibit tracked")
+	}
+	expectProperty(t, "Inhibited", false)
+	expectNoTimeout(t, c)
+	fake.SetError("")
+	c.Activity("/dev/input/js0", "")
+	if !c.Inhibited() || fake.Inhibited() != 1 {
+		t.Fatal("not inhibited after error")
+	}
+	expectProperty(t, "Inhibited", true)
+}
+
+func TestInhibitControllerReason(t *testing.T) {
+	c, fake, _ := newTestInhibitController(t)
+	c.Activity("/dev/input/js0", "SuperTuxKart")
+	if calls := fake.Calls(); len(calls) != 1 || calls[0].Args[1] != "SuperTuxKart (gamepad)" {
+		t.Errorf("unexpected calls %v", calls)
+	}
+	// Unknown applications keep the reason
+	c.Activity("/dev/input/js0", "")
+	c.Activity("/dev/input/js0", "SuperTuxKart")
+	if n := len(fake.Calls()); n != 1 {
+		t.Fatalf("%d calls, expected 1", n)
+	}
+	// Applications that are active at the same time don't reissue the inhibit
+	for i := 0; i < 10; i++ {
+		c.Activity("/dev/input/js1", "Portal 2")
+		c.Activity("/dev/input/js0", "SuperTuxKart")
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Fatalf("%d calls with alternating applications, expected 1", n)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(testTimeout / 2)
+		c.Activity("/dev/input/js1", "Portal 2")
+	}
+	if calls := fake.Calls(); len(calls) != 3 || calls[2].Args[1] != "Portal 2 (gamepad)" {
+		t.Errorf("reason not updated: %v", calls)
+	}
+	if !c.Inhibited() || fake.Inhibited() != 1 {
+		t.Fatal("not inhibited")
+	}
+	expectProperty(t, "Inhibited", true)
+}
+
+func TestInhibitControllerLastActivity(t *testing.T) {
+	c, _, _ := newTestInhibitController(t)
+	c.Activity("/dev/input/js0", "")
+	lastActivity := getProperty(t, "LastActivity").(int64)
+	if lastActivity == 0 {
+		t.Fatal("LastActivity not set")
+	}
+	time.Sleep(testTimeout)
+	c.Activity("/dev/input/js0", "")
+	expectProperty(t, "LastActivity", lastActivity)
+}
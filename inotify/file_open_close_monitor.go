@@ -20,11 +20,14 @@
 package inotify
 
 import (
+	"errors"
 	"fmt"
+	"github.com/unrud/joystick-monitor/reactor"
 	"io"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"syscall"
 	"unsafe"
 )
@@ -44,83 +47,186 @@ type Event struct {
 
 type FileOpenCloseMonitor struct {
 	inotify   *os.File
+	inotifyFd int
 	watchPath string
+	reactor   *reactor.Reactor
+	buf       [4096]byte
 
-	e chan error
-	E <-chan error
-	c chan Event
-	C <-chan Event
+	// Files with the prefix are watched individually
+	prefix  string
+	watchWd int32
+	fileWds map[int32]string
+
+	mutex  sync.Mutex
+	events []Event
+	err    error
+
+	// Take must be called after receiving from C
+	c chan struct{}
+	C <-chan struct{}
+}
+
+// NewFileOpenCloseMonitor reports files in the directory that are opened or closed
+func NewFileOpenCloseMonitor(watchPath string, r *reactor.Reactor) (*FileOpenCloseMonitor, error) {
+	return newFileOpenCloseMonitor(watchPath, "", r)
+}
+
+// NewPrefixFileOpenCloseMonitor reports files in the directory whose names
+// start with prefix that are opened or closed. The files are watched
+// individually to skip the events of other files in busy directories like
+// /dev. Created files are reported as opened, because they might have been
+// opened before the watch was added.
+func NewPrefixFileOpenCloseMonitor(watchPath, prefix string, r *reactor.Reactor) (*FileOpenCloseMonitor, error) {
+	return newFileOpenCloseMonitor(watchPath, prefix, r)
 }
 
-func NewFileOpenCloseMonitor(watchPath string) (*FileOpenCloseMonitor, error) {
-	var inotify *os.File
-	if inotifyFd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK); err != nil {
+func newFileOpenCloseMonitor(watchPath, prefix string, r *reactor.Reactor) (*FileOpenCloseMonitor, error) {
+	inotifyFd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
 		return nil, fmt.Errorf("InotifyInit1: %w", err)
-	} else {
-		inotify = os.NewFile(uintptr(inotifyFd), fmt.Sprintf("inotify(%d)", inotifyFd))
 	}
-	if _, err := syscall.InotifyAddWatch(int(inotify.Fd()), watchPath, syscall.IN_OPEN|syscall.IN_CLOSE); err != nil {
+	// Fd() of os.File would switch to blocking mode
+	inotify := os.NewFile(uintptr(inotifyFd), fmt.Sprintf("inotify(%d)", inotifyFd))
+	var mask uint32 = syscall.IN_OPEN | syscall.IN_CLOSE
+	if prefix != "" {
+		mask = syscall.IN_CREATE
+	}
+	watchWd, err := syscall.InotifyAddWatch(inotifyFd, watchPath, mask)
+	if err != nil {
 		inotify.Close()
 		return nil, fmt.Errorf("InotifyAddWatch %v: %w", watchPath, err)
 	}
-	chanC := make(chan Event)
-	chanE := make(chan error)
+	chanC := make(chan struct{}, 1)
 	m := &FileOpenCloseMonitor{
 		inotify:   inotify,
+		inotifyFd: inotifyFd,
 		watchPath: watchPath,
+		reactor:   r,
+		prefix:    prefix,
+		watchWd:   int32(watchWd),
+		fileWds:   make(map[int32]string),
 
 		c: chanC,
 		C: chanC,
-		e: chanE,
-		E: chanE,
 	}
-	go m.task()
+	if prefix != "" {
+		entries, err := os.ReadDir(watchPath)
+		if err != nil {
+			inotify.Close()
+			return nil, err
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), prefix) {
+				if err := m.watchFile(path.Join(watchPath, entry.Name())); err != nil {
+					inotify.Close()
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := r.Add(inotify, m.read); err != nil {
+		inotify.Close()
+		return nil, err
+	}
 	return m, nil
 }
 
-func (m *FileOpenCloseMonitor) task() {
-	var buf [4096]byte
-	for {
-		size, err := m.inotify.Read(buf[:])
-		if err != nil {
-			m.e <- err
-			return
+func (m *FileOpenCloseMonitor) watchFile(filePath string) error {
+	wd, err := syscall.InotifyAddWatch(m.inotifyFd, filePath, syscall.IN_OPEN|syscall.IN_CLOSE)
+	if errors.Is(err, syscall.ENOENT) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("InotifyAddWatch %v: %w", filePath, err)
+	}
+	m.fileWds[int32(wd)] = filePath
+	return nil
+}
+
+func (m *FileOpenCloseMonitor) notify() {
+	select {
+	case m.c <- struct{}{}:
+	default:
+	}
+}
+
+// read is the handler of the reactor
+func (m *FileOpenCloseMonitor) read() bool {
+	size, err := reactor.Read(m.inotify, m.buf[:])
+	if errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	var events []Event
+	if err == nil {
+		events, err = m.parse(m.buf[:size])
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.events = append(m.events, events...)
+	if err != nil {
+		m.err = err
+	}
+	m.notify()
+	return err == nil
+}
+
+func (m *FileOpenCloseMonitor) parse(eventsData []byte) (events []Event, err error) {
+	for len(eventsData) > 0 {
+		if len(eventsData) < syscall.SizeofInotifyEvent {
+			return events, fmt.Errorf("read %v: %w", m.inotify.Name(), io.ErrUnexpectedEOF)
 		}
-		eventsData := buf[:size]
-		for {
-			if len(eventsData) < syscall.SizeofInotifyEvent {
-				m.e <- fmt.Errorf("read %v: %w", m.inotify.Name(), io.ErrUnexpectedEOF)
-				return
-			}
-			event := (*syscall.InotifyEvent)(unsafe.Pointer(&eventsData[0]))
-			eventsData = eventsData[syscall.SizeofInotifyEvent:]
-			if event.Len > uint32(len(eventsData)) {
-				m.e <- fmt.Errorf("read %v: %w", m.inotify.Name(), io.ErrUnexpectedEOF)
-				return
-			}
-			eventName, _, _ := strings.Cut(string(eventsData[:int(event.Len)]), "\x00")
-			eventsData = eventsData[int(event.Len):]
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&eventsData[0]))
+		eventsData = eventsData[syscall.SizeofInotifyEvent:]
+		if event.Len > uint32(len(eventsData)) {
+			return events, fmt.Errorf("read %v: %w", m.inotify.Name(), io.ErrUnexpectedEOF)
+		}
+		eventName, _, _ := strings.Cut(string(eventsData[:int(event.Len)]), "\x00")
+		eventsData = eventsData[int(event.Len):]
+		eventPath := path.Join(m.watchPath, eventName)
+		if filePath, found := m.fileWds[event.Wd]; found {
+			eventPath = filePath
 			if event.Mask&syscall.IN_IGNORED != 0 {
-				m.e <- fmt.Errorf("read %v: watch %v ignored", m.inotify.Name(), m.watchPath)
-				return
+				// The file was removed
+				delete(m.fileWds, event.Wd)
+				continue
 			}
-			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
-				m.c <- Event{EventOverflow, ""}
-			} else if event.Mask&syscall.IN_ISDIR == 0 {
-				if event.Mask&syscall.IN_OPEN != 0 {
-					m.c <- Event{EventOpen, path.Join(m.watchPath, eventName)}
-				}
-				if event.Mask&syscall.IN_CLOSE != 0 {
-					m.c <- Event{EventClose, path.Join(m.watchPath, eventName)}
+		} else if event.Mask&syscall.IN_IGNORED != 0 && event.Wd == m.watchWd {
+			return events, fmt.Errorf("read %v: watch %v ignored", m.inotify.Name(), m.watchPath)
+		}
+		if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			events = append(events, Event{EventOverflow, ""})
+		} else if event.Mask&syscall.IN_ISDIR == 0 {
+			if event.Mask&syscall.IN_CREATE != 0 && strings.HasPrefix(eventName, m.prefix) {
+				if err := m.watchFile(eventPath); err != nil {
+					return events, err
 				}
+				events = append(events, Event{EventOpen, eventPath})
 			}
-			if len(eventsData) == 0 {
-				break
+			if event.Mask&syscall.IN_OPEN != 0 {
+				events = append(events, Event{EventOpen, eventPath})
+			}
+			if event.Mask&syscall.IN_CLOSE != 0 {
+				events = append(events, Event{EventClose, eventPath})
 			}
 		}
 	}
+	return events, nil
+}
+
+// Take returns and removes the queued events, the error is returned after
+// the events that were read before it
+func (m *FileOpenCloseMonitor) Take() ([]Event, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	events := m.events
+	m.events = nil
+	return events, m.err
 }
 
 func (m *FileOpenCloseMonitor) Close() error {
+	if err := m.reactor.Remove(m.inotify); err != nil {
+		m.inotify.Close()
+		return err
+	}
 	return m.inotify.Close()
 }
@@ -0,0 +1,94 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package inotify
+
+import (
+	"github.com/unrud/joystick-monitor/reactor"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func takeEvents(t *testing.T, m *FileOpenCloseMonitor, count int) (events []Event) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for len(events) < count {
+		select {
+		case <-m.C:
+			newEvents, err := m.Take()
+			if err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, newEvents...)
+		case <-timeout:
+			t.Fatalf("got %v, expected %v events", events, count)
+		}
+	}
+	return events
+}
+
+func openClose(t *testing.T, name string) {
+	t.Helper()
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+}
+
+func TestPrefixFileOpenCloseMonitor(t *testing.T) {
+	r, err := reactor.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	dir := t.TempDir()
+	existing, created, other := path.Join(dir, "hidraw0"), path.Join(dir, "hidraw1"), path.Join(dir, "null")
+	for _, name := range []string{existing, other} {
+		if err := os.WriteFile(name, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewPrefixFileOpenCloseMonitor(dir, "hidraw", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	openClose(t, other)
+	openClose(t, existing)
+	if events := takeEvents(t, m, 2); !reflect.DeepEqual(events, []Event{{EventOpen, existing}, {EventClose, existing}}) {
+		t.Errorf("existing file: got %v", events)
+	}
+	if err := os.WriteFile(created, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if events := takeEvents(t, m, 1); events[0] != (Event{EventOpen, created}) {
+		t.Errorf("created file: got %v", events)
+	}
+	// Skip the close of the creation that races with adding the watch
+	time.Sleep(50 * time.Millisecond)
+	m.Take()
+	openClose(t, created)
+	if events := takeEvents(t, m, 2); !reflect.DeepEqual(events, []Event{{EventOpen, created}, {EventClose, created}}) {
+		t.Errorf("opened created file: got %v", events)
+	}
+}
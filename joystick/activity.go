@@ -0,0 +1,76 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"fmt"
+	"time"
+)
+
+type ActivityKind int
+
+const (
+	KindButton ActivityKind = iota
+	KindAxis
+	KindHat
+)
+
+func (k ActivityKind) String() string {
+	switch k {
+	case KindButton:
+		return "button"
+	case KindAxis:
+		return "axis"
+	case KindHat:
+		return "hat"
+	}
+	return fmt.Sprintf("ActivityKind(%d)", int(k))
+}
+
+func absKind(code uint16) ActivityKind {
+	if code >= absHat0x && code <= absHat3y {
+		return KindHat
+	}
+	return KindAxis
+}
+
+type ActivityEvent struct {
+	Device *Device
+	Kind   ActivityKind
+	// Code of the button or axis (e.g. BTN_SOUTH or ABS_X), the number of the
+	// control for legacy joysticks without mapping
+	Code  uint16
+	Value int32
+	// Kernel timestamp (time of reading for hidraw devices), only comparable
+	// with events of the same device
+	Time time.Duration
+}
+
+// origin returns the controller or the device of the event
+func (e *ActivityEvent) origin() fmt.Stringer {
+	if e.Device.Controller != nil {
+		return e.Device.Controller
+	}
+	return e.Device
+}
+
+func (e ActivityEvent) String() string {
+	return fmt.Sprintf("%v %v %#x=%v", e.Device, e.Kind, e.Code, e.Value)
+}
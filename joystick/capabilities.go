@@ -0,0 +1,140 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	evRel             = 0x02
+	absX              = 0x00
+	absY              = 0x01
+	absBrake          = 0x0a
+	absHat0x          = 0x10
+	absHat3y          = 0x17
+	btnMisc           = 0x100
+	btnMouse          = 0x110
+	btnTask           = 0x117
+	btnJoystick       = 0x120
+	btnThumbR         = 0x13e
+	btnToolPen        = 0x140
+	btnToolFinger     = 0x145
+	btnTouch          = 0x14a
+	btnTriggerHappy   = 0x2c0
+	btnTriggerHappy40 = 0x2e7
+)
+
+// bitmap is the representation of capabilities in sysfs: hexadecimal words
+// of the size of long separated by spaces, the most significant word first
+type bitmap []uint64
+
+func parseBitmap(s string) bitmap {
+	fields := strings.Fields(s)
+	var b bitmap
+	for i := len(fields) - 1; i >= 0; i-- {
+		word, _ := strconv.ParseUint(fields[i], 16, strconv.IntSize)
+		b = append(b, word)
+	}
+	return b
+}
+
+func (b bitmap) has(bit int) bool {
+	i := bit / strconv.IntSize
+	return i < len(b) && b[i]&(1<<(bit%strconv.IntSize)) != 0
+}
+
+func (b bitmap) hasAny(first, last int) bool {
+	for bit := first; bit <= last; bit++ {
+		if b.has(bit) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasJoystickCapabilities is similar to the detection of udev's input_id.
+// Motion sensors are only accepted if they belong to the same device as a
+// joystick, because other devices (e.g. laptops) have accelerometers too.
+func hasJoystickCapabilities(sysfsDevice string) bool {
+	if parseBitmap(readSysfsAttribute(sysfsDevice, "properties")).has(inputPropAccelerometer) {
+		return hasJoystickSibling(sysfsDevice)
+	}
+	return hasControlCapabilities(sysfsDevice)
+}
+
+// hasJoystickSibling checks if another input device of the parent device has
+// the capabilities of a joystick
+func hasJoystickSibling(sysfsDevice string) bool {
+	resolved, err := filepath.EvalSymlinks(sysfsDevice)
+	if err != nil {
+		return false
+	}
+	entries, err := os.ReadDir(path.Dir(resolved))
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		sibling := path.Join(path.Dir(resolved), entry.Name())
+		if strings.HasPrefix(entry.Name(), "input") && sibling != resolved && hasControlCapabilities(sibling) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasControlCapabilities(sysfsDevice string) bool {
+	keys := parseBitmap(readSysfsAttribute(sysfsDevice, "capabilities/key"))
+	if keys.hasAny(btnJoystick, btnThumbR) || keys.hasAny(btnTriggerHappy, btnTriggerHappy40) {
+		return true
+	}
+	events := parseBitmap(readSysfsAttribute(sysfsDevice, "capabilities/ev"))
+	// Absolute pointers with mouse buttons are tablets (e.g. of virtual machines)
+	if !events.has(evAbs) || events.has(evRel) || keys.hasAny(btnMouse, btnTask) ||
+		keys.has(btnToolPen) || keys.has(btnToolFinger) || keys.has(btnTouch) {
+		return false
+	}
+	axes := parseBitmap(readSysfsAttribute(sysfsDevice, "capabilities/abs"))
+	return axes.has(absX) && axes.has(absY) &&
+		(axes.hasAny(absRx, absBrake) || axes.hasAny(absHat0x, absHat3y) || !keys.hasAny(0, btnMisc-1))
+}
+
+func udevProperties(sysfsClassDevice string) map[string]string {
+	properties := make(map[string]string)
+	dev := readSysfsAttribute(sysfsClassDevice, "dev")
+	if dev == "" {
+		return properties
+	}
+	data, err := os.ReadFile(path.Join("/run/udev/data", "c"+dev))
+	if err != nil {
+		return properties
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "E:") {
+			key, value, _ := strings.Cut(strings.TrimPrefix(line, "E:"), "=")
+			properties[key] = value
+		}
+	}
+	return properties
+}
@@ -0,0 +1,118 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBitmap(t *testing.T) {
+	b := parseBitmap("7fdb000000000000 0 0 0 0\n")
+	for bit, expected := range map[int]bool{0: false, 0x130: true, 0x131: true, 0x132: false, 0x13e: true, 0x13f: false, 0x400: false} {
+		if b.has(bit) != expected {
+			t.Errorf("bit %#x: got %v, expected %v", bit, !expected, expected)
+		}
+	}
+}
+
+func TestCountBits(t *testing.T) {
+	b := parseBitmap("7fdb000000000000 0 0 0 0\n")
+	if count := countBits(b, btnMisc, keyCnt-1); count != 13 {
+		t.Errorf("buttons: got %v, expected 13", count)
+	}
+	if count := countBits(parseBitmap("3003f"), 0, absCnt-1); count != 8 {
+		t.Errorf("axes: got %v, expected 8", count)
+	}
+}
+
+func TestHasJoystickCapabilities(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		attributes map[string]string
+		expected   bool
+	}{
+		{"gamepad", map[string]string{
+			"capabilities/ev":  "20001b",
+			"capabilities/key": "7fdb000000000000 0 0 0 0",
+			"capabilities/abs": "3003f",
+		}, true},
+		{"trigger happy", map[string]string{
+			"capabilities/ev":  "3",
+			"capabilities/key": "f 0 0 0 0 0 0 0 0 0 0 0",
+		}, true},
+		{"flight stick without buttons", map[string]string{
+			"capabilities/ev":  "9",
+			"capabilities/abs": "67",
+		}, true},
+		{"motion sensors", map[string]string{
+			"input1/properties":       "40",
+			"input1/capabilities/ev":  "19",
+			"input1/capabilities/abs": "3f",
+			"input0/capabilities/ev":  "20001b",
+			"input0/capabilities/key": "7fdb000000000000 0 0 0 0",
+			"input0/capabilities/abs": "3003f",
+		}, true},
+		{"accelerometer without joystick", map[string]string{
+			"input1/properties":       "40",
+			"input1/capabilities/ev":  "9",
+			"input1/capabilities/abs": "7",
+			"input0/capabilities/ev":  "120013",
+			"input0/capabilities/key": "fffffffffffffffe",
+		}, false},
+		{"touchpad", map[string]string{
+			"capabilities/ev":  "b",
+			"capabilities/key": "e520 10000 0 0 0 0",
+			"capabilities/abs": "2608000 3",
+		}, false},
+		{"mouse", map[string]string{
+			"capabilities/ev":  "17",
+			"capabilities/key": "1f0000 0 0 0 0",
+			"capabilities/rel": "903",
+		}, false},
+		{"virtual machine tablet", map[string]string{
+			"capabilities/ev":  "1b",
+			"capabilities/key": "1f0000 0 0 0 0",
+			"capabilities/abs": "3",
+		}, false},
+		{"keyboard", map[string]string{
+			"capabilities/ev":  "120013",
+			"capabilities/key": "fffffffffffffffe",
+		}, false},
+	} {
+		dir := t.TempDir()
+		for name, value := range test.attributes {
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sysfsDevice := dir
+		if _, err := os.Stat(filepath.Join(dir, "input1")); err == nil {
+			sysfsDevice = filepath.Join(dir, "input1")
+		}
+		if result := hasJoystickCapabilities(sysfsDevice); result != test.expected {
+			t.Errorf("%v: got %v, expected %v", test.name, result, test.expected)
+		}
+	}
+}
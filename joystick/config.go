@@ -0,0 +1,75 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"time"
+)
+
+type Config struct {
+	// Fraction of the axis range that counts as activity
+	AxisThreshold ControlSetting
+	// Fraction of the axis range around the center (or above the minimum
+	// of triggers and pedals) that is ignored, in addition to the flat zone
+	// reported by the driver
+	Deadzone ControlSetting
+	// Angular velocity in degrees per second above which motion sensors
+	// count as activity, motion sensors are ignored if 0
+	MotionThreshold ControlSetting
+	// Maximal deviation in seconds between the intervals of repeated
+	// button presses that are ignored as periodic, disabled if 0
+	PeriodicTolerance ControlSetting
+	// Controls that are the only source of activity for longer are
+	// ignored until other input arrives, disabled if 0
+	StuckTimeout time.Duration
+}
+
+func NewConfig() *Config {
+	return &Config{
+		AxisThreshold:     ControlSetting{Default: 1.0 / 8},
+		StuckTimeout:      30 * time.Minute,
+		PeriodicTolerance: ControlSetting{Default: 0.01},
+	}
+}
+
+// MotionEnabled checks if any gyroscope axis of the motion sensor has a
+// threshold
+func (c *Config) MotionEnabled(device *Device) bool {
+	for code := uint16(absRx); code <= absRz; code++ {
+		if c.MotionThreshold.get(device, control{evAbs, code}) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func scaleThreshold(rangeSize uint32, fraction float64) uint32 {
+	if fraction >= 1 {
+		return rangeSize
+	}
+	return uint32(float64(rangeSize) * fraction)
+}
+
+func abs32(v int32) uint32 {
+	if v < 0 {
+		return uint32(-int64(v))
+	}
+	return uint32(v)
+}
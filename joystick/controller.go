@@ -0,0 +1,275 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"errors"
+	"fmt"
+	"github.com/unrud/joystick-monitor/processes"
+	"github.com/unrud/joystick-monitor/reactor"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const sysfsVirtualInputDir = "/sys/devices/virtual/input"
+
+// Controller is a physical controller with all its input nodes (e.g. joystick,
+// touchpad and motion sensors)
+type Controller struct {
+	// Parent device in sysfs shared by the input nodes
+	ID      string
+	Devices []*Device
+}
+
+func controllerID(d *Device) string {
+	if d.PhysicalID != "" {
+		return d.PhysicalID
+	}
+	if d.SysfsPath == "" {
+		return d.Path
+	}
+	if IsHidrawPath(d.Path) {
+		// The parent device of input devices
+		return d.SysfsPath
+	}
+	parent := filepath.Dir(d.SysfsPath)
+	if parent == sysfsVirtualInputDir {
+		// Virtual input devices don't share a parent device
+		return d.SysfsPath
+	}
+	if filepath.Base(parent) == "input" {
+		// Input devices are grouped in the input directory of the parent
+		parent = filepath.Dir(parent)
+	}
+	return parent
+}
+
+// isInputJoystick checks if the device is the joystick of an input device
+// that belongs to a physical parent device
+func isInputJoystick(d *Device) bool {
+	return d.Class == ClassJoystick && d.SysfsPath != "" && d.PhysicalID == "" && !IsHidrawPath(d.Path)
+}
+
+// controllerIDs returns the IDs of the controllers of the devices. Parent
+// devices with several joysticks (e.g. adapters for multiple controllers) are
+// split into one controller per input device.
+func controllerIDs(devices map[string]*Device) map[*Device]string {
+	inputJoysticks := make(map[string]map[string]struct{})
+	for _, d := range devices {
+		if isInputJoystick(d) {
+			id := controllerID(d)
+			if inputJoysticks[id] == nil {
+				inputJoysticks[id] = make(map[string]struct{})
+			}
+			inputJoysticks[id][d.SysfsPath] = struct{}{}
+		}
+	}
+	ids := make(map[*Device]string)
+	for _, d := range devices {
+		id := controllerID(d)
+		if isInputJoystick(d) && len(inputJoysticks[id]) > 1 {
+			id = d.SysfsPath
+		}
+		ids[d] = id
+	}
+	return ids
+}
+
+// GroupDevices groups the devices by controller. Only the event device is
+// kept if the legacy joystick device of the same input device is present and
+// hidraw devices are only kept for controllers without event joystick devices.
+func GroupDevices(devices map[string]*Device) map[string]*Controller {
+	eventDevices := make(map[string]struct{})
+	eventJoysticks := make(map[string]struct{})
+	for _, d := range devices {
+		if d.SysfsPath != "" && !IsLegacyJoystickPath(d.Path) && !IsHidrawPath(d.Path) {
+			eventDevices[d.SysfsPath] = struct{}{}
+			if d.Class == ClassJoystick {
+				eventJoysticks[controllerID(d)] = struct{}{}
+			}
+		}
+	}
+	ids := controllerIDs(devices)
+	controllers := make(map[string]*Controller)
+	for _, d := range devices {
+		if _, found := eventDevices[d.SysfsPath]; found && IsLegacyJoystickPath(d.Path) {
+			continue
+		}
+		if _, found := eventJoysticks[controllerID(d)]; found && IsHidrawPath(d.Path) {
+			continue
+		}
+		id := ids[d]
+		controller, found := controllers[id]
+		if !found {
+			controller = &Controller{ID: id}
+			controllers[id] = controller
+		}
+		controller.Devices = append(controller.Devices, d)
+		d.Controller = controller
+	}
+	for _, controller := range controllers {
+		sort.Slice(controller.Devices, func(i, j int) bool {
+			return controller.Devices[i].Path < controller.Devices[j].Path
+		})
+	}
+	return controllers
+}
+
+// Name returns the name of the main joystick device, physical devices are
+// preferred over linked virtual devices
+func (c *Controller) Name() string {
+	for _, virtual := range []bool{false, true} {
+		for _, d := range c.Devices {
+			if d.Class == ClassJoystick && d.Name != "" && d.IsVirtual() == virtual {
+				return d.Name
+			}
+		}
+	}
+	for _, d := range c.Devices {
+		if d.Name != "" {
+			return d.Name
+		}
+	}
+	return c.ID
+}
+
+func (c *Controller) Paths() (paths []string) {
+	for _, d := range c.Devices {
+		paths = append(paths, d.Path)
+	}
+	return paths
+}
+
+// Processes returns the processes that have input nodes of the controller
+// open, sorted by their IDs
+func (c *Controller) Processes() (holders []*processes.Process) {
+	seen := make(map[int]struct{})
+	for _, d := range c.Devices {
+		for _, p := range d.Holders {
+			if _, found := seen[p.Pid]; !found {
+				seen[p.Pid] = struct{}{}
+				holders = append(holders, p)
+			}
+		}
+	}
+	sort.Slice(holders, func(i, j int) bool { return holders[i].Pid < holders[j].Pid })
+	return holders
+}
+
+// Application returns the process that uses the controller. Processes that
+// created virtual devices of the controller are only returned if there is no
+// other process and more recently started processes are preferred (e.g. the
+// game over its launcher).
+func (c *Controller) Application() *processes.Process {
+	creators := make(map[int]struct{})
+	for _, d := range c.Devices {
+		if d.Creator != nil {
+			creators[d.Creator.Pid] = struct{}{}
+		}
+	}
+	var application *processes.Process
+	applicationIsCreator := false
+	for _, p := range c.Processes() {
+		_, isCreator := creators[p.Pid]
+		if application == nil || applicationIsCreator && !isCreator ||
+			applicationIsCreator == isCreator && p.StartTime >= application.StartTime {
+			application, applicationIsCreator = p, isCreator
+		}
+	}
+	return application
+}
+
+func (c *Controller) String() string {
+	var nodes []string
+	for _, d := range c.Devices {
+		if d.IsVirtual() && d.Creator != nil {
+			nodes = append(nodes, fmt.Sprintf("%v from %v", d.Path, d.Creator))
+		} else {
+			nodes = append(nodes, d.Path)
+		}
+	}
+	var holders []string
+	for _, p := range c.Processes() {
+		holders = append(holders, p.String())
+	}
+	if len(holders) == 0 {
+		return fmt.Sprintf("%v (%v)", c.Name(), strings.Join(nodes, ", "))
+	}
+	return fmt.Sprintf("%v (%v) used by %v", c.Name(), strings.Join(nodes, ", "), strings.Join(holders, ", "))
+}
+
+// ControllerMonitor combines the monitors of the input nodes of a controller
+// and filters stuck and periodic input. The monitors are read by the reactor.
+type ControllerMonitor struct {
+	Controller *Controller
+	monitors   []*JoystickMonitor
+	reactor    *reactor.Reactor
+	queue      *ActivityQueue
+	periodic   *periodicDetector
+	stuck      *stuckDetector
+}
+
+func NewControllerMonitor(controller *Controller, monitors []*JoystickMonitor, config *Config,
+	r *reactor.Reactor, queue *ActivityQueue) (*ControllerMonitor, error) {
+	m := &ControllerMonitor{
+		Controller: controller,
+		reactor:    r,
+		queue:      queue,
+		periodic:   newPeriodicDetector(config),
+		stuck:      newStuckDetector(config.StuckTimeout),
+	}
+	for _, monitor := range monitors {
+		monitor.emit = m.activity
+		monitor.fail = m.fail
+		if err := r.Add(monitor.joystick, monitor.read); err != nil {
+			m.Close()
+			for _, monitor := range monitors[len(m.monitors):] {
+				monitor.Close()
+			}
+			return nil, err
+		}
+		m.monitors = append(m.monitors, monitor)
+	}
+	return m, nil
+}
+
+func (m *ControllerMonitor) activity(event ActivityEvent) {
+	if m.periodic.filter(&event) && m.stuck.filter(&event) {
+		m.queue.push(m, event)
+	}
+}
+
+func (m *ControllerMonitor) fail(err error) {
+	m.queue.fail(m, err)
+}
+
+func (m *ControllerMonitor) Close() (err error) {
+	for _, monitor := range m.monitors {
+		if removeErr := m.reactor.Remove(monitor.joystick); removeErr != nil && !errors.Is(removeErr, os.ErrClosed) && err == nil {
+			err = removeErr
+		}
+		if closeErr := monitor.Close(); closeErr != nil && !errors.Is(closeErr, os.ErrClosed) && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
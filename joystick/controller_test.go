@@ -0,0 +1,100 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"github.com/unrud/joystick-monitor/processes"
+	"reflect"
+	"testing"
+)
+
+func TestGroupDevices(t *testing.T) {
+	const (
+		hid     = "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-1/1-1:1.3/0003:054C:0CE6.0001"
+		adapter = "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:0079:1844.0002"
+	)
+	devices := map[string]*Device{}
+	for _, d := range []*Device{
+		{Path: "/dev/input/js0", Name: "Sony Interactive Entertainment DualSense Wireless Controller", SysfsPath: hid + "/input/input10"},
+		{Path: "/dev/input/event10", Name: "Sony Interactive Entertainment DualSense Wireless Controller", SysfsPath: hid + "/input/input10"},
+		{Path: "/dev/input/event11", Name: "Sony Interactive Entertainment DualSense Wireless Controller Motion Sensors", SysfsPath: hid + "/input/input11", Class: ClassMotionSensor},
+		{Path: "/dev/input/js1", Name: "Legacy Stick", SysfsPath: "/sys/devices/platform/stick/input/input12"},
+		{Path: "/dev/input/event20", Name: "Virtual Pad 1", SysfsPath: sysfsVirtualInputDir + "/input20"},
+		{Path: "/dev/input/event21", Name: "Virtual Pad 2", SysfsPath: sysfsVirtualInputDir + "/input21"},
+		{Path: "/dev/input/js2", Name: "mayflash limited MAYFLASH GameCube Controller Adapter", SysfsPath: adapter + "/input/input30"},
+		{Path: "/dev/input/event30", Name: "mayflash limited MAYFLASH GameCube Controller Adapter", SysfsPath: adapter + "/input/input30"},
+		{Path: "/dev/input/event31", Name: "mayflash limited MAYFLASH GameCube Controller Adapter", SysfsPath: adapter + "/input/input31"},
+		{Path: "/dev/hidraw2", Name: "mayflash limited MAYFLASH GameCube Controller Adapter", SysfsPath: adapter},
+	} {
+		devices[d.Path] = d
+	}
+	controllers := GroupDevices(devices)
+	for id, expected := range map[string][]string{
+		hid:                               {"/dev/input/event10", "/dev/input/event11"},
+		"/sys/devices/platform/stick":     {"/dev/input/js1"},
+		sysfsVirtualInputDir + "/input20": {"/dev/input/event20"},
+		sysfsVirtualInputDir + "/input21": {"/dev/input/event21"},
+		adapter + "/input/input30":        {"/dev/input/event30"},
+		adapter + "/input/input31":        {"/dev/input/event31"},
+	} {
+		controller, found := controllers[id]
+		if !found {
+			t.Errorf("controller %v missing", id)
+			continue
+		}
+		if paths := controller.Paths(); !reflect.DeepEqual(paths, expected) {
+			t.Errorf("controller %v: got %v, expected %v", id, paths, expected)
+		}
+	}
+	if len(controllers) != 6 {
+		t.Errorf("got %v controllers, expected 6", len(controllers))
+	}
+	dualSense := controllers[hid]
+	if name := dualSense.Name(); name != "Sony Interactive Entertainment DualSense Wireless Controller" {
+		t.Errorf("got name %q", name)
+	}
+	if !devices["/dev/input/event11"].matches("Sony Interactive Entertainment DualSense Wireless Controller") {
+		t.Error("motion sensors don't match the name of the controller")
+	}
+}
+
+func TestControllerApplication(t *testing.T) {
+	steam := &processes.Process{Pid: 100, Comm: "steam", StartTime: 1000}
+	launcher := &processes.Process{Pid: 300, Comm: "launcher", StartTime: 2000}
+	game := &processes.Process{Pid: 200, Comm: "supertuxkart", StartTime: 3000}
+	controller := &Controller{Devices: []*Device{
+		{Path: "/dev/input/event20", Creator: steam, Holders: []*processes.Process{game, launcher}},
+		{Path: "/dev/input/event21", Creator: steam, Holders: []*processes.Process{steam, game}},
+	}}
+	if holders := controller.Processes(); !reflect.DeepEqual(holders, []*processes.Process{steam, game, launcher}) {
+		t.Errorf("got processes %v", holders)
+	}
+	if application := controller.Application(); application != game {
+		t.Errorf("got application %v, expected %v", application, game)
+	}
+	controller.Devices = controller.Devices[1:2]
+	controller.Devices[0].Holders = []*processes.Process{steam}
+	if application := controller.Application(); application != steam {
+		t.Errorf("got application %v, expected %v", application, steam)
+	}
+	if application := (&Controller{}).Application(); application != nil {
+		t.Errorf("got application %v without processes", application)
+	}
+}
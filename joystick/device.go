@@ -0,0 +1,199 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"fmt"
+	"github.com/unrud/joystick-monitor/processes"
+	"math/bits"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const (
+	BusUSB       = 0x03
+	BusBluetooth = 0x05
+	BusVirtual   = 0x06
+
+	keyCnt = 0x300
+)
+
+type DeviceClass int
+
+const (
+	ClassJoystick DeviceClass = iota
+	ClassMotionSensor
+)
+
+func (c DeviceClass) String() string {
+	switch c {
+	case ClassJoystick:
+		return "joystick"
+	case ClassMotionSensor:
+		return "motion sensor"
+	}
+	return fmt.Sprintf("DeviceClass(%d)", int(c))
+}
+
+type Device struct {
+	Path                              string
+	Name                              string
+	BusType, Vendor, Product, Version uint16
+	Uniq, Phys                        string
+	// Input device in sysfs (e.g. /sys/devices/.../input/input17)
+	SysfsPath     string
+	Axes, Buttons int
+	Class         DeviceClass
+	// Process that created the virtual device and the ID of the physical
+	// controller it forwards, set by LinkVirtualDevices if known
+	Creator    *processes.Process
+	PhysicalID string
+	// Processes that have the device open
+	Holders []*processes.Process
+	// Set for devices that are grouped by GroupDevices
+	Controller *Controller
+}
+
+func readSysfsAttribute(dir, name string) string {
+	data, err := os.ReadFile(path.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysfsHex(dir, name string) uint16 {
+	value, _ := strconv.ParseUint(readSysfsAttribute(dir, name), 16, 16)
+	return uint16(value)
+}
+
+func countBits(b bitmap, first, last int) (count int) {
+	for i, word := range b {
+		for bit := 0; bit < strconv.IntSize; bit++ {
+			if n := i*strconv.IntSize + bit; n >= first && n <= last && word&(1<<bit) != 0 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// NewDevice reads the information about the device from sysfs
+func NewDevice(devicePath string) *Device {
+	dir := path.Join(sysfsInputDir, path.Base(devicePath), "device")
+	d := &Device{
+		Path:    devicePath,
+		Name:    readSysfsAttribute(dir, "name"),
+		BusType: readSysfsHex(dir, "id/bustype"),
+		Vendor:  readSysfsHex(dir, "id/vendor"),
+		Product: readSysfsHex(dir, "id/product"),
+		Version: readSysfsHex(dir, "id/version"),
+		Uniq:    readSysfsAttribute(dir, "uniq"),
+		Phys:    readSysfsAttribute(dir, "phys"),
+		Axes:    countBits(parseBitmap(readSysfsAttribute(dir, "capabilities/abs")), 0, absCnt-1),
+		Buttons: countBits(parseBitmap(readSysfsAttribute(dir, "capabilities/key")), btnMisc, keyCnt-1),
+	}
+	if sysfsPath, err := filepath.EvalSymlinks(dir); err == nil {
+		d.SysfsPath = sysfsPath
+	}
+	if parseBitmap(readSysfsAttribute(dir, "properties")).has(inputPropAccelerometer) {
+		d.Class = ClassMotionSensor
+	}
+	return d
+}
+
+func ioctlString(file *os.File, name string, typ, nr uintptr) (string, error) {
+	var buf [256]byte
+	if err := ioctl(file, name, ioc(iocRead, typ, nr, unsafe.Sizeof(buf)), unsafe.Pointer(&buf)); err != nil {
+		return "", err
+	}
+	s, _, _ := strings.Cut(string(buf[:]), "\x00")
+	return s, nil
+}
+
+// queryEvent updates the information with the ioctls of the event interface
+func (d *Device) queryEvent(file *os.File) {
+	if name, err := ioctlString(file, "EVIOCGNAME", 'E', 0x06); err == nil {
+		d.Name = name
+	}
+	if phys, err := ioctlString(file, "EVIOCGPHYS", 'E', 0x07); err == nil {
+		d.Phys = phys
+	}
+	if uniq, err := ioctlString(file, "EVIOCGUNIQ", 'E', 0x08); err == nil {
+		d.Uniq = uniq
+	}
+	var id [4]uint16
+	if err := ioctl(file, "EVIOCGID", ioc(iocRead, 'E', 0x02, unsafe.Sizeof(id)), unsafe.Pointer(&id)); err == nil {
+		d.BusType, d.Vendor, d.Product, d.Version = id[0], id[1], id[2], id[3]
+	}
+	var axes [absCnt / 8]byte
+	if err := ioctl(file, "EVIOCGBIT", ioc(iocRead, 'E', 0x20+evAbs, unsafe.Sizeof(axes)), unsafe.Pointer(&axes)); err == nil {
+		d.Axes = 0
+		for _, b := range axes {
+			d.Axes += bits.OnesCount8(b)
+		}
+	}
+	var keys [keyCnt / 8]byte
+	if err := ioctl(file, "EVIOCGBIT", ioc(iocRead, 'E', 0x20+evKey, unsafe.Sizeof(keys)), unsafe.Pointer(&keys)); err == nil {
+		d.Buttons = 0
+		for _, b := range keys[btnMisc/8:] {
+			d.Buttons += bits.OnesCount8(b)
+		}
+	}
+	var props [inputPropCnt / 8]byte
+	if err := ioctl(file, "EVIOCGPROP", ioc(iocRead, 'E', 0x09, unsafe.Sizeof(props)), unsafe.Pointer(&props)); err == nil {
+		if props[inputPropAccelerometer/8]&(1<<(inputPropAccelerometer%8)) != 0 {
+			d.Class = ClassMotionSensor
+		} else {
+			d.Class = ClassJoystick
+		}
+	}
+}
+
+// queryLegacy updates the information with the ioctls of the joystick interface
+func (d *Device) queryLegacy(file *os.File) {
+	if name, err := ioctlString(file, "JSIOCGNAME", 'j', 0x13); err == nil {
+		d.Name = name
+	}
+	var count uint8
+	if err := ioctl(file, "JSIOCGAXES", ioc(iocRead, 'j', 0x11, unsafe.Sizeof(count)), unsafe.Pointer(&count)); err == nil {
+		d.Axes = int(count)
+	}
+	if err := ioctl(file, "JSIOCGBUTTONS", ioc(iocRead, 'j', 0x12, unsafe.Sizeof(count)), unsafe.Pointer(&count)); err == nil {
+		d.Buttons = int(count)
+	}
+	d.Class = ClassJoystick
+}
+
+func (d *Device) matches(device string) bool {
+	return device == d.Name || strings.EqualFold(device, fmt.Sprintf("%04x:%04x", d.Vendor, d.Product)) ||
+		d.Controller != nil && device == d.Controller.Name()
+}
+
+func (d *Device) String() string {
+	if d.Name == "" {
+		return d.Path
+	}
+	return fmt.Sprintf("%v (%v)", d.Name, d.Path)
+}
@@ -0,0 +1,264 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"errors"
+)
+
+const (
+	hidPageGenericDesktop = 0x01
+	hidPageSimulation     = 0x02
+	hidPageButton         = 0x09
+
+	hidUsageJoystick         = 0x04
+	hidUsageGamepad          = 0x05
+	hidUsageMultiAxis        = 0x08
+	hidUsageX                = 0x30
+	hidUsageWheel            = 0x38
+	hidUsageHatSwitch        = 0x39
+	hidUsageRudder           = 0xba
+	hidUsageThrottle         = 0xbb
+	hidUsageAccelerator      = 0xc4
+	hidUsageBrake            = 0xc5
+	hidUsageSteering         = 0xc8
+	hidCollectionApplication = 0x01
+
+	absThrottle = 0x06
+	absRudder   = 0x07
+	absWheel    = 0x08
+	absGas      = 0x09
+	btnGamepad  = 0x130
+)
+
+var errHidDescriptor = errors.New("invalid HID report descriptor")
+
+// hidField is a variable input field of a game controller with the evdev
+// type and code it corresponds to
+type hidField struct {
+	reportID     uint8
+	offset, size int
+	min, max     int32
+	control      control
+}
+
+// value extracts the field from a report without the report ID
+func (f *hidField) value(report []byte) (int32, bool) {
+	if f.size <= 0 || f.size > 32 || (f.offset+f.size+7)/8 > len(report) {
+		return 0, false
+	}
+	var raw uint64
+	for i := f.offset / 8; i <= (f.offset+f.size-1)/8; i++ {
+		raw |= uint64(report[i]) << (8 * (i - f.offset/8))
+	}
+	raw = raw >> (f.offset % 8) & (1<<f.size - 1)
+	if f.min < 0 && raw&(1<<(f.size-1)) != 0 {
+		return int32(int64(raw) - 1<<f.size), true
+	}
+	return int32(raw), true
+}
+
+type hidDescriptor struct {
+	fields    []hidField
+	reportIDs bool
+}
+
+type hidGlobals struct {
+	usagePage               uint16
+	logicalMin, logicalMax  int32
+	logicalMaxRaw           uint32
+	reportSize, reportCount int
+	reportID                uint8
+}
+
+// hidControl maps HID usages to evdev controls like the kernel does
+func hidControl(page, usage uint16, gamepad bool, hats *int) (control, bool) {
+	switch {
+	case page == hidPageButton && usage > 0:
+		if gamepad {
+			return control{evKey, btnGamepad + usage - 1}, true
+		}
+		return control{evKey, btnJoystick + usage - 1}, true
+	case page == hidPageGenericDesktop && usage >= hidUsageX && usage <= hidUsageWheel:
+		return control{evAbs, usage - hidUsageX}, true
+	case page == hidPageGenericDesktop && usage == hidUsageHatSwitch && *hats <= (absHat3y-absHat0x)/2:
+		*hats++
+		return control{evAbs, absHat0x + uint16(*hats-1)*2}, true
+	case page == hidPageSimulation:
+		for _, m := range []struct{ usage, code uint16 }{
+			{hidUsageRudder, absRudder}, {hidUsageThrottle, absThrottle}, {hidUsageAccelerator, absGas},
+			{hidUsageBrake, absBrake}, {hidUsageSteering, absWheel},
+		} {
+			if usage == m.usage {
+				return control{evAbs, m.code}, true
+			}
+		}
+	}
+	return control{}, false
+}
+
+// parseHidDescriptor returns the fields of joystick, gamepad and multi-axis
+// controller application collections that map to evdev controls
+func parseHidDescriptor(data []byte) (*hidDescriptor, error) {
+	d := &hidDescriptor{}
+	var globals hidGlobals
+	var globalsStack []hidGlobals
+	var usages []uint32
+	var usageMin, usageMax uint32
+	var hasUsageRange bool
+	offsets := make(map[uint8]int)
+	depth, controllerDepth := 0, -1
+	gamepad := false
+	hats := 0
+	for len(data) > 0 {
+		prefix := data[0]
+		if prefix == 0xfe {
+			// Long item
+			if len(data) < 3 || len(data) < 3+int(data[1]) {
+				return nil, errHidDescriptor
+			}
+			data = data[3+int(data[1]):]
+			continue
+		}
+		size := [4]int{0, 1, 2, 4}[prefix&3]
+		if len(data) < 1+size {
+			return nil, errHidDescriptor
+		}
+		var raw uint32
+		for i := 0; i < size; i++ {
+			raw |= uint32(data[1+i]) << (8 * i)
+		}
+		signed := int32(raw)
+		if size > 0 && size < 4 && raw&(1<<(8*size-1)) != 0 {
+			signed = int32(int64(raw) - 1<<(8*size))
+		}
+		data = data[1+size:]
+		switch typ, tag := (prefix>>2)&3, prefix>>4; typ {
+		case 0: // Main
+			switch tag {
+			case 0x8: // Input
+				// Limits the fields of crafted descriptors
+				if globals.reportSize == 0 || globals.reportCount > 0x10000 ||
+					globals.reportSize*globals.reportCount > 0x10000 {
+					return nil, errHidDescriptor
+				}
+				for n := 0; controllerDepth >= 0 && raw&1 == 0 && raw&2 != 0 && n < globals.reportCount; n++ {
+					var usage uint32
+					if len(usages) > 0 {
+						usage = usages[len(usages)-1]
+						if n < len(usages) {
+							usage = usages[n]
+						}
+					} else if hasUsageRange && usageMin+uint32(n) <= usageMax {
+						usage = usageMin + uint32(n)
+					} else {
+						continue
+					}
+					page := uint16(usage >> 16)
+					if page == 0 {
+						page = globals.usagePage
+					}
+					if c, ok := hidControl(page, uint16(usage), gamepad, &hats); ok {
+						max := globals.logicalMax
+						if max < globals.logicalMin {
+							// Maximum encoded without sign bit
+							max = int32(globals.logicalMaxRaw)
+						}
+						d.fields = append(d.fields, hidField{
+							reportID: globals.reportID,
+							offset:   offsets[globals.reportID] + n*globals.reportSize,
+							size:     globals.reportSize,
+							min:      globals.logicalMin,
+							max:      max,
+							control:  c,
+						})
+					}
+				}
+				offsets[globals.reportID] += globals.reportSize * globals.reportCount
+			case 0xa: // Collection
+				if raw == hidCollectionApplication && controllerDepth < 0 && len(usages) > 0 {
+					usage := usages[0]
+					page := uint16(usage >> 16)
+					if page == 0 {
+						page = globals.usagePage
+					}
+					if page == hidPageGenericDesktop && (uint16(usage) == hidUsageJoystick ||
+						uint16(usage) == hidUsageGamepad || uint16(usage) == hidUsageMultiAxis) {
+						controllerDepth = depth
+						gamepad = uint16(usage) == hidUsageGamepad
+						hats = 0
+					}
+				}
+				depth++
+			case 0xc: // End Collection
+				if depth--; depth == controllerDepth {
+					controllerDepth = -1
+				}
+			}
+			usages, hasUsageRange = nil, false
+		case 1: // Global
+			switch tag {
+			case 0x0:
+				globals.usagePage = uint16(raw)
+			case 0x1:
+				globals.logicalMin = signed
+			case 0x2:
+				globals.logicalMax, globals.logicalMaxRaw = signed, raw
+			case 0x7:
+				globals.reportSize = int(raw)
+			case 0x8:
+				globals.reportID = uint8(raw)
+				d.reportIDs = true
+			case 0x9:
+				globals.reportCount = int(raw)
+			case 0xa:
+				globalsStack = append(globalsStack, globals)
+			case 0xb:
+				if len(globalsStack) == 0 {
+					return nil, errHidDescriptor
+				}
+				globals = globalsStack[len(globalsStack)-1]
+				globalsStack = globalsStack[:len(globalsStack)-1]
+			}
+		case 2: // Local
+			switch tag {
+			case 0x0:
+				usages = append(usages, raw)
+			case 0x1:
+				usageMin, hasUsageRange = raw, true
+			case 0x2:
+				usageMax, hasUsageRange = raw, true
+			}
+		}
+	}
+	return d, nil
+}
+
+// counts returns the number of axes and buttons
+func (d *hidDescriptor) counts() (axes, buttons int) {
+	for _, f := range d.fields {
+		if f.control.typ == evKey {
+			buttons++
+		} else {
+			axes++
+		}
+	}
+	return axes, buttons
+}
@@ -0,0 +1,140 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"testing"
+)
+
+var testGamepadDescriptor = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x05, // Usage (Gamepad)
+	0xa1, 0x01, // Collection (Application)
+	0x85, 0x01, // Report ID (1)
+	0x05, 0x09, 0x19, 0x01, 0x29, 0x08, // Usage Page (Button), Usage Minimum (1), Usage Maximum (8)
+	0x15, 0x00, 0x25, 0x01, 0x75, 0x01, 0x95, 0x08, 0x81, 0x02, // 8 buttons
+	0x05, 0x01, 0x09, 0x30, 0x09, 0x31, // Usage Page (Generic Desktop), Usage (X), Usage (Y)
+	0x15, 0x00, 0x26, 0xff, 0x00, 0x75, 0x08, 0x95, 0x02, 0x81, 0x02, // 2 axes 0..255
+	0x09, 0x39, 0x15, 0x00, 0x25, 0x07, 0x75, 0x04, 0x95, 0x01, 0x81, 0x42, // Hat switch
+	0x75, 0x04, 0x95, 0x01, 0x81, 0x03, // Padding
+	0x09, 0x32, 0x15, 0x81, 0x25, 0x7f, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02, // Z -127..127
+	0x06, 0x00, 0xff, 0x09, 0x20, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02, // Vendor defined
+	0xc0, // End Collection
+}
+
+var testMouseDescriptor = []byte{
+	0x05, 0x01, 0x09, 0x02, 0xa1, 0x01, 0x09, 0x01, 0xa1, 0x00,
+	0x05, 0x09, 0x19, 0x01, 0x29, 0x03, 0x15, 0x00, 0x25, 0x01, 0x95, 0x03, 0x75, 0x01, 0x81, 0x02,
+	0x95, 0x01, 0x75, 0x05, 0x81, 0x03,
+	0x05, 0x01, 0x09, 0x30, 0x09, 0x31, 0x15, 0x81, 0x25, 0x7f, 0x75, 0x08, 0x95, 0x02, 0x81, 0x06,
+	0xc0, 0xc0,
+}
+
+func TestParseHidDescriptor(t *testing.T) {
+	d, err := parseHidDescriptor(testGamepadDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.reportIDs || len(d.fields) != 12 {
+		t.Fatalf("got %v fields, report IDs %v", len(d.fields), d.reportIDs)
+	}
+	if axes, buttons := d.counts(); axes != 4 || buttons != 8 {
+		t.Errorf("got %v axes and %v buttons", axes, buttons)
+	}
+	report := []byte{0x05, 0x80, 0x10, 0xf8, 0xff, 0x42}
+	for i, expected := range []struct {
+		control control
+		value   int32
+	}{
+		{control{evKey, btnGamepad}, 1}, {control{evKey, btnGamepad + 1}, 0}, {control{evKey, btnGamepad + 2}, 1},
+		{control{evKey, btnGamepad + 3}, 0}, {control{evKey, btnGamepad + 4}, 0}, {control{evKey, btnGamepad + 5}, 0},
+		{control{evKey, btnGamepad + 6}, 0}, {control{evKey, btnGamepad + 7}, 0},
+		{control{evAbs, absX}, 0x80}, {control{evAbs, absY}, 0x10}, {control{evAbs, absHat0x}, 8},
+		{control{evAbs, 0x02}, -1},
+	} {
+		field := d.fields[i]
+		if field.reportID != 1 || field.control != expected.control {
+			t.Errorf("field %v: got report %v control %v, expected %v", i, field.reportID, field.control, expected.control)
+		}
+		if value, ok := field.value(report); !ok || value != expected.value {
+			t.Errorf("field %v: got %v, expected %v", i, value, expected.value)
+		}
+	}
+	if d.fields[8].max != 255 || d.fields[11].min != -127 {
+		t.Errorf("got logical ranges %v..%v and %v..%v", d.fields[8].min, d.fields[8].max, d.fields[11].min, d.fields[11].max)
+	}
+	if d, err := parseHidDescriptor(testMouseDescriptor); err != nil || len(d.fields) != 0 {
+		t.Errorf("mouse: got %v, %v", d, err)
+	}
+	if _, err := parseHidDescriptor(testGamepadDescriptor[:len(testGamepadDescriptor)-2]); err == nil {
+		t.Error("truncated descriptor accepted")
+	}
+	for _, invalid := range [][]byte{
+		// Report size 0 with report count 2^32-1
+		{0x05, 0x01, 0x09, 0x05, 0xa1, 0x01, 0x05, 0x09, 0x19, 0x01, 0x29, 0x10,
+			0x75, 0x00, 0x97, 0xff, 0xff, 0xff, 0xff, 0x81, 0x02, 0xc0},
+		// Report size 1 with report count 2^20
+		{0x05, 0x01, 0x09, 0x05, 0xa1, 0x01, 0x05, 0x09, 0x19, 0x01, 0x29, 0x10,
+			0x75, 0x01, 0x97, 0x00, 0x00, 0x10, 0x00, 0x81, 0x02, 0xc0},
+	} {
+		if _, err := parseHidDescriptor(invalid); err == nil {
+			t.Errorf("descriptor %x accepted", invalid)
+		}
+	}
+}
+
+func TestHidrawJoystickMonitor(t *testing.T) {
+	d, err := parseHidDescriptor(testGamepadDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []ActivityEvent
+	m := &hidrawJoystickMonitor{
+		JoystickMonitor: JoystickMonitor{Device: &Device{Path: "/dev/hidraw0"}},
+		config:          NewConfig(),
+		descriptor:      d,
+		state:           make([]hidrawFieldState, len(d.fields)),
+	}
+	m.emit = func(event ActivityEvent) { events = append(events, event) }
+	for _, test := range []struct {
+		name     string
+		report   []byte
+		expected []control
+	}{
+		{"initial", []byte{0x01, 0x00, 0x80, 0x80, 0x08, 0x00, 0x00}, nil},
+		{"other report", []byte{0x02, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00}, nil},
+		{"noise", []byte{0x01, 0x00, 0x82, 0x7e, 0x08, 0x00, 0x00}, nil},
+		{"button", []byte{0x01, 0x02, 0x82, 0x7e, 0x08, 0x00, 0x00}, []control{{evKey, btnGamepad + 1}}},
+		{"stick", []byte{0x01, 0x02, 0xff, 0x7e, 0x08, 0x00, 0x00}, []control{{evAbs, absX}}},
+		{"hat", []byte{0x01, 0x02, 0xff, 0x7e, 0x02, 0x00, 0x00}, []control{{evAbs, absHat0x}}},
+	} {
+		events = nil
+		if err := m.handleReport(test.report); err != nil {
+			t.Fatal(err)
+		}
+		var controls []control
+		for _, event := range events {
+			controls = append(controls, eventControl(&event))
+		}
+		if len(controls) != len(test.expected) || len(controls) > 0 && controls[0] != test.expected[0] {
+			t.Errorf("%v: got %v, expected %v", test.name, controls, test.expected)
+		}
+	}
+}
@@ -19,19 +19,28 @@
 
 package joystick
 
-func ListAllJoysticks() (map[string]struct{}, error) {
-	joysticks := make(map[string]struct{})
-	for _, listJoysticksFn := range []func() (map[string]struct{}, error){
+func ListAllJoysticks() (map[string]*Device, error) {
+	joysticks := make(map[string]*Device)
+	for _, listJoysticksFn := range []func() (map[string]*Device, error){
 		ListEventJoysticks,
 		ListLegacyJoysticks,
+		ListHidrawJoysticks,
 	} {
 		tempJoysticks, err := listJoysticksFn()
 		if err != nil {
 			return nil, err
 		}
-		for tempJoystick := range tempJoysticks {
-			joysticks[tempJoystick] = struct{}{}
+		for tempJoystick, device := range tempJoysticks {
+			joysticks[tempJoystick] = device
 		}
 	}
 	return joysticks, nil
 }
+
+// IsJoystick checks if the device node belongs to a joystick
+func IsJoystick(devicePath string) (bool, error) {
+	if IsLegacyJoystickPath(devicePath) || IsHidrawJoystick(devicePath) {
+		return true, nil
+	}
+	return IsEventJoystick(devicePath)
+}
@@ -26,7 +26,41 @@ import (
 	"strings"
 )
 
-func ListEventJoysticks() (map[string]struct{}, error) {
+const sysfsInputDir = "/sys/class/input"
+
+func ListEventJoysticks() (map[string]*Device, error) {
+	joysticks := make(map[string]*Device)
+	for _, listJoysticksFn := range []func() (map[string]struct{}, error){
+		listByIdEventJoysticks,
+		listSysfsEventJoysticks,
+	} {
+		tempJoysticks, err := listJoysticksFn()
+		if err != nil {
+			return nil, err
+		}
+		for tempJoystick := range tempJoysticks {
+			joysticks[tempJoystick] = NewDevice(tempJoystick)
+		}
+	}
+	return joysticks, nil
+}
+
+func IsEventJoystick(devicePath string) (bool, error) {
+	if path.Dir(devicePath) != "/dev/input" || !strings.HasPrefix(path.Base(devicePath), "event") {
+		return false, nil
+	}
+	if isSysfsEventJoystick(path.Base(devicePath)) {
+		return true, nil
+	}
+	joysticks, err := listByIdEventJoysticks()
+	if err != nil {
+		return false, err
+	}
+	_, found := joysticks[devicePath]
+	return found, nil
+}
+
+func listByIdEventJoysticks() (map[string]struct{}, error) {
 	joysticks := make(map[string]struct{})
 	inputByIdDir, err := os.Open("/dev/input/by-id")
 	if errors.Is(err, os.ErrNotExist) {
@@ -60,3 +94,33 @@ func ListEventJoysticks() (map[string]struct{}, error) {
 	}
 	return joysticks, nil
 }
+
+// listSysfsEventJoysticks finds joysticks that are labeled by udev or that have
+// the capabilities of joysticks
+func listSysfsEventJoysticks() (map[string]struct{}, error) {
+	joysticks := make(map[string]struct{})
+	inputDir, err := os.Open(sysfsInputDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return joysticks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer inputDir.Close()
+	inputEntries, err := inputDir.ReadDir(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, inputEntry := range inputEntries {
+		if strings.HasPrefix(inputEntry.Name(), "event") && isSysfsEventJoystick(inputEntry.Name()) {
+			joysticks[path.Join("/dev/input", inputEntry.Name())] = struct{}{}
+		}
+	}
+	return joysticks, nil
+}
+
+func isSysfsEventJoystick(name string) bool {
+	classDevice := path.Join(sysfsInputDir, name)
+	return udevProperties(classDevice)["ID_INPUT_JOYSTICK"] == "1" ||
+		hasJoystickCapabilities(path.Join(classDevice, "device"))
+}
@@ -0,0 +1,113 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const sysfsHidrawDir = "/sys/class/hidraw"
+
+func IsHidrawPath(devicePath string) bool {
+	const prefix = "/dev/hidraw"
+	if !strings.HasPrefix(devicePath, prefix) {
+		return false
+	}
+	after := strings.TrimPrefix(devicePath, prefix)
+	nr, _ := strconv.Atoi(after)
+	return strconv.Itoa(nr) == after
+}
+
+// readHidDescriptor reads the report descriptor of the hidraw device from sysfs
+func readHidDescriptor(name string) (*hidDescriptor, error) {
+	data, err := os.ReadFile(path.Join(sysfsHidrawDir, name, "device", "report_descriptor"))
+	if err != nil {
+		return nil, err
+	}
+	return parseHidDescriptor(data)
+}
+
+func newHidrawDevice(devicePath string, descriptor *hidDescriptor) *Device {
+	dir := path.Join(sysfsHidrawDir, path.Base(devicePath), "device")
+	d := &Device{Path: devicePath}
+	d.Axes, d.Buttons = descriptor.counts()
+	uevent, _ := os.ReadFile(path.Join(dir, "uevent"))
+	for _, line := range strings.Split(string(uevent), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "HID_NAME":
+			d.Name = value
+		case "HID_PHYS":
+			d.Phys = value
+		case "HID_UNIQ":
+			d.Uniq = value
+		case "HID_ID":
+			// BUS:VENDOR:PRODUCT with 4 and 8 hex digits
+			if ids := strings.Split(value, ":"); len(ids) == 3 {
+				for i, id := range []*uint16{&d.BusType, &d.Vendor, &d.Product} {
+					value, _ := strconv.ParseUint(ids[i], 16, 32)
+					*id = uint16(value)
+				}
+			}
+		}
+	}
+	if sysfsPath, err := filepath.EvalSymlinks(dir); err == nil {
+		d.SysfsPath = sysfsPath
+	}
+	return d
+}
+
+func ListHidrawJoysticks() (map[string]*Device, error) {
+	joysticks := make(map[string]*Device)
+	hidrawDir, err := os.Open(sysfsHidrawDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return joysticks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer hidrawDir.Close()
+	hidrawEntries, err := hidrawDir.ReadDir(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, hidrawEntry := range hidrawEntries {
+		descriptor, err := readHidDescriptor(hidrawEntry.Name())
+		if err != nil || len(descriptor.fields) == 0 {
+			continue
+		}
+		joystick := path.Join("/dev", hidrawEntry.Name())
+		joysticks[joystick] = newHidrawDevice(joystick, descriptor)
+	}
+	return joysticks, nil
+}
+
+func IsHidrawJoystick(devicePath string) bool {
+	if !IsHidrawPath(devicePath) {
+		return false
+	}
+	descriptor, err := readHidDescriptor(path.Base(devicePath))
+	return err == nil && len(descriptor.fields) > 0
+}
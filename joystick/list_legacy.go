@@ -36,8 +36,8 @@ func IsLegacyJoystickPath(path string) bool {
 	return strconv.Itoa(nr) == after
 }
 
-func ListLegacyJoysticks() (map[string]struct{}, error) {
-	joysticks := make(map[string]struct{})
+func ListLegacyJoysticks() (map[string]*Device, error) {
+	joysticks := make(map[string]*Device)
 	inputDir, err := os.Open("/dev/input")
 	if err != nil {
 		return nil, err
@@ -50,7 +50,7 @@ func ListLegacyJoysticks() (map[string]struct{}, error) {
 	for _, inputEntry := range inputEntries {
 		joystick := path.Join(inputDir.Name(), inputEntry.Name())
 		if IsLegacyJoystickPath(joystick) {
-			joysticks[joystick] = struct{}{}
+			joysticks[joystick] = NewDevice(joystick)
 		}
 	}
 	return joysticks, nil
@@ -20,16 +20,57 @@
 package joystick
 
 import (
+	"errors"
+	"fmt"
+	"github.com/unrud/joystick-monitor/reactor"
+	"io"
 	"os"
+	"syscall"
 )
 
 type JoystickMonitor struct {
 	joystick *os.File
+	Device   *Device
+	buf      [4096]byte
 
-	c chan struct{}
-	C <-chan struct{}
-	e chan error
-	E <-chan error
+	// parse handles the events of one read
+	parse func(data []byte) error
+	emit  func(event ActivityEvent)
+	fail  func(err error)
+}
+
+func newJoystickMonitor(joystick *os.File, device *Device) JoystickMonitor {
+	return JoystickMonitor{joystick: joystick, Device: device}
+}
+
+// read is the handler of the reactor
+func (m *JoystickMonitor) read() bool {
+	size, err := reactor.Read(m.joystick, m.buf[:])
+	if errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	if err == nil && size == 0 {
+		err = fmt.Errorf("read %v: %w", m.joystick.Name(), io.EOF)
+	}
+	if err == nil {
+		err = m.parse(m.buf[:size])
+	}
+	if err != nil {
+		m.fail(err)
+		return false
+	}
+	return true
+}
+
+// NewJoystickMonitor creates the monitor for the interface of the device node
+func NewJoystickMonitor(joystick *os.File, device *Device, config *Config) (*JoystickMonitor, error) {
+	switch {
+	case IsLegacyJoystickPath(device.Path):
+		return NewLegacyJoystickMonitor(joystick, device, config), nil
+	case IsHidrawPath(device.Path):
+		return NewHidrawJoystickMonitor(joystick, device, config)
+	}
+	return NewEventJoystickMonitor(joystick, device, config), nil
 }
 
 func (m *JoystickMonitor) Close() error {
@@ -24,12 +24,25 @@ import (
 	"io"
 	"os"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
 const (
-	evKey = 0x01
-	evAbs = 0x03
+	evSyn  = 0x00
+	evKey  = 0x01
+	evAbs  = 0x03
+	absZ   = 0x02
+	absRx  = 0x03
+	absRy  = 0x04
+	absRz  = 0x05
+	absCnt = 0x40
+
+	synReport  = 0x00
+	synDropped = 0x03
+
+	inputPropAccelerometer = 0x06
+	inputPropCnt           = 0x20
 )
 
 type inputEvent struct {
@@ -44,90 +57,225 @@ type inputAbsinfo struct {
 }
 
 type joystickAxis struct {
-	absinfo  inputAbsinfo
-	min, max int32
+	absinfo      inputAbsinfo
+	threshold    uint32
+	center, flat int32
+	value        int32
+	min, max     int32
+}
+
+func (state *joystickAxis) flatten(value int32) int32 {
+	if abs32(value-state.center) <= uint32(state.flat) {
+		return state.center
+	}
+	return value
+}
+
+// isOneSided checks if the axis is a trigger or pedal that rests at the
+// minimum. ABS_Z and ABS_RZ are sticks on some devices, so the axis must be
+// near the minimum initially.
+func isOneSided(absinfo inputAbsinfo, code uint16, value int32) bool {
+	switch code {
+	case absZ, absRz, absThrottle, absGas, absBrake:
+		return uint32(value-absinfo.Minimum) < uint32(absinfo.Maximum-absinfo.Minimum)/4
+	}
+	return false
+}
+
+func newJoystickAxis(absinfo inputAbsinfo, config *Config, device *Device, code uint16, value int32) joystickAxis {
+	state := joystickAxis{absinfo: absinfo}
+	rangeSize := uint32(absinfo.Maximum - absinfo.Minimum)
+	c := control{evAbs, code}
+	state.threshold = scaleThreshold(rangeSize, config.AxisThreshold.get(device, c))
+	state.center = absinfo.Minimum + int32(rangeSize/2)
+	if isOneSided(absinfo, code, value) {
+		// The flat zone starts at the resting position
+		state.center = absinfo.Minimum
+	}
+	state.flat = int32(scaleThreshold(rangeSize, config.Deadzone.get(device, c)))
+	if state.flat < absinfo.Flat {
+		state.flat = absinfo.Flat
+	}
+	state.value = state.flatten(value)
+	state.min = state.value
+	state.max = state.value
+	return state
+}
+
+// filter centers values inside the flat zone and discards noise below fuzz
+func (state *joystickAxis) filter(value int32) (int32, bool) {
+	value = state.flatten(value)
+	if abs32(value-state.value) < uint32(state.absinfo.Fuzz) {
+		return value, false
+	}
+	state.value = value
+	return value, true
+}
+
+// update returns the value if the axis moved further than the threshold
+func (state *joystickAxis) update(value int32) (int32, bool) {
+	value, ok := state.filter(value)
+	if !ok {
+		return 0, false
+	}
+	if value < state.min {
+		state.min = value
+	}
+	if value > state.max {
+		state.max = value
+	}
+	if uint32(state.max-state.min) <= state.threshold {
+		return 0, false
+	}
+	state.min = value
+	state.max = value
+	return value, true
 }
 
 type eventJoystickMonitor struct {
 	JoystickMonitor
-	axis map[uint16]joystickAxis
+	config  *Config
+	axis    map[uint16]joystickAxis
+	keys    [keyCnt / 8]byte
+	dropped bool
+	// Query the state of the device, replaced in tests
+	queryKeys func(keys *[keyCnt / 8]byte) error
+	absinfo   func(code uint16) (inputAbsinfo, error)
 }
 
-func NewEventJoystickMonitor(joystick *os.File) *JoystickMonitor {
-	chanC := make(chan struct{})
-	chanE := make(chan error)
+func NewEventJoystickMonitor(joystick *os.File, device *Device, config *Config) *JoystickMonitor {
+	queriedDevice := *device
+	queriedDevice.queryEvent(joystick)
 	m := &eventJoystickMonitor{
-		JoystickMonitor: JoystickMonitor{joystick, chanC, chanC, chanE, chanE},
+		JoystickMonitor: newJoystickMonitor(joystick, &queriedDevice),
+		config:          config,
 		axis:            make(map[uint16]joystickAxis),
+		queryKeys: func(keys *[keyCnt / 8]byte) error {
+			return ioctl(joystick, "EVIOCGKEY", ioc(iocRead, 'E', 0x18, unsafe.Sizeof(*keys)), unsafe.Pointer(keys))
+		},
+		absinfo: func(code uint16) (absinfo inputAbsinfo, err error) {
+			err = ioctl(joystick, "EVIOCGABS", ioc(iocRead, 'E', 0x40+uintptr(code), unsafe.Sizeof(absinfo)), unsafe.Pointer(&absinfo))
+			return
+		},
 	}
-	go m.task()
+	// Buttons are assumed to be released if the state is unavailable
+	m.queryKeys(&m.keys)
+	m.JoystickMonitor.parse = m.handleEvents
 	return &m.JoystickMonitor
 }
 
-func (m *eventJoystickMonitor) task() {
-	var buf [4096]byte
-	for {
-		size, err := m.joystick.Read(buf[:])
-		if err != nil {
-			m.e <- err
-			return
-		}
-		eventsData := buf[:size]
-		for {
-			if len(eventsData) < int(unsafe.Sizeof(inputEvent{})) {
-				m.e <- fmt.Errorf("read %v: %w", m.joystick.Name(), io.ErrUnexpectedEOF)
-				return
-			}
-			event := (*inputEvent)(unsafe.Pointer(&eventsData[0]))
-			eventsData = eventsData[int(unsafe.Sizeof(inputEvent{})):]
-			if event.Type == evAbs {
-				state, stateSet := m.axis[event.Code]
-				if !stateSet {
-					// EVIOCGABS
-					var requestCode uint32
-					requestCode |= 2 << 30
-					requestCode |= uint32(unsafe.Sizeof(state.absinfo)) << 16
-					requestCode |= uint32('E') << 8
-					requestCode |= 0x40 + uint32(event.Code)
-					conn, err := m.joystick.SyscallConn()
-					if err != nil {
-						m.e <- err
-						return
-					}
-					var errno syscall.Errno
-					if err := conn.Control(func(fd uintptr) {
-						_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(requestCode), uintptr(unsafe.Pointer(&state.absinfo)))
-					}); err != nil {
-						m.e <- err
-						return
-					}
-					if errno != 0 {
-						m.e <- fmt.Errorf("fcntl %v %v: %w", m.joystick.Name(), "EVIOCGABS", syscall.Errno(errno))
-						return
-					}
-					state.min = event.Value
-					state.max = event.Value
-				} else {
-					if event.Value < state.min {
-						state.min = event.Value
-					}
-					if event.Value > state.max {
-						state.max = event.Value
-					}
-					if uint32(state.max-state.min) > uint32(state.absinfo.Maximum-state.absinfo.Minimum)/8 {
-						state.min = event.Value
-						state.max = event.Value
-						m.c <- struct{}{}
-					}
-				}
-				m.axis[event.Code] = state
+func (m *eventJoystickMonitor) activity(kind ActivityKind, event *inputEvent, value int32) {
+	m.emit(ActivityEvent{
+		Device: m.Device,
+		Kind:   kind,
+		Code:   event.Code,
+		Value:  value,
+		Time:   time.Duration(event.Time.Nano()),
+	})
+}
+
+func (m *eventJoystickMonitor) handleAbs(event *inputEvent) error {
+	state, stateSet := m.axis[event.Code]
+	if m.Device.Class == ClassMotionSensor {
+		// Motion sensors only count if the angular velocity exceeds the threshold
+		if !stateSet {
+			var err error
+			if state.absinfo, err = m.absinfo(event.Code); err != nil {
+				return err
 			}
-			if event.Type == evKey {
-				m.c <- struct{}{}
+			if event.Code >= absRx && event.Code <= absRz {
+				state.threshold = uint32(m.config.MotionThreshold.get(m.Device, control{evAbs, event.Code}) *
+					float64(state.absinfo.Resolution))
 			}
-			if len(eventsData) == 0 {
-				break
+			m.axis[event.Code] = state
+		}
+		if state.threshold > 0 && abs32(event.Value) > state.threshold {
+			m.activity(KindAxis, event, event.Value)
+		}
+		return nil
+	}
+	if !stateSet {
+		absinfo, err := m.absinfo(event.Code)
+		if err != nil {
+			return err
+		}
+		state = newJoystickAxis(absinfo, m.config, m.Device, event.Code, event.Value)
+	} else if value, ok := state.update(event.Value); ok {
+		m.activity(absKind(event.Code), event, value)
+	}
+	m.axis[event.Code] = state
+	return nil
+}
+
+func (m *eventJoystickMonitor) handleKey(event *inputEvent) {
+	if int(event.Code) < keyCnt {
+		if event.Value != 0 {
+			m.keys[event.Code/8] |= 1 << (event.Code % 8)
+		} else {
+			m.keys[event.Code/8] &^= 1 << (event.Code % 8)
+		}
+	}
+	m.activity(KindButton, event, event.Value)
+}
+
+// resync queries the state of the device after events were dropped and
+// handles the differences like events
+func (m *eventJoystickMonitor) resync(report *inputEvent) error {
+	var keys [keyCnt / 8]byte
+	if err := m.queryKeys(&keys); err != nil {
+		return err
+	}
+	for code := 0; code < keyCnt; code++ {
+		if pressed := keys[code/8]&(1<<(code%8)) != 0; pressed != (m.keys[code/8]&(1<<(code%8)) != 0) {
+			event := inputEvent{Time: report.Time, Type: evKey, Code: uint16(code)}
+			if pressed {
+				event.Value = 1
 			}
+			m.handleKey(&event)
+		}
+	}
+	for code := range m.axis {
+		absinfo, err := m.absinfo(code)
+		if err != nil {
+			return err
+		}
+		if err := m.handleAbs(&inputEvent{Time: report.Time, Type: evAbs, Code: code, Value: absinfo.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *eventJoystickMonitor) handleEvent(event *inputEvent) error {
+	if m.dropped {
+		// The state is incomplete until the next report
+		if event.Type == evSyn && event.Code == synReport {
+			m.dropped = false
+			return m.resync(event)
+		}
+		return nil
+	}
+	switch event.Type {
+	case evSyn:
+		m.dropped = event.Code == synDropped
+	case evKey:
+		m.handleKey(event)
+	case evAbs:
+		return m.handleAbs(event)
+	}
+	return nil
+}
+
+func (m *eventJoystickMonitor) handleEvents(eventsData []byte) error {
+	for len(eventsData) > 0 {
+		if len(eventsData) < int(unsafe.Sizeof(inputEvent{})) {
+			return fmt.Errorf("read %v: %w", m.joystick.Name(), io.ErrUnexpectedEOF)
+		}
+		event := (*inputEvent)(unsafe.Pointer(&eventsData[0]))
+		eventsData = eventsData[int(unsafe.Sizeof(inputEvent{})):]
+		if err := m.handleEvent(event); err != nil {
+			return err
 		}
 	}
+	return nil
 }
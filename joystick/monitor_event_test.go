@@ -0,0 +1,112 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJoystickAxisDeadzone(t *testing.T) {
+	config := NewConfig()
+	if err := config.Deadzone.Set("0.1"); err != nil {
+		t.Fatal(err)
+	}
+	device := &Device{Name: "Gamepad"}
+	absinfo := inputAbsinfo{Minimum: 0, Maximum: 1000}
+	for _, test := range []struct {
+		name           string
+		code           uint16
+		initial, value int32
+		expected       int32
+	}{
+		{"stick near center", absRx, 500, 550, 500},
+		{"stick outside deadzone", absRx, 500, 650, 650},
+		{"trigger at rest", absRz, 0, 50, 0},
+		{"trigger outside deadzone", absRz, 0, 150, 150},
+		{"stick on ABS_Z", absZ, 500, 550, 500},
+	} {
+		state := newJoystickAxis(absinfo, config, device, test.code, test.initial)
+		if value := state.flatten(test.value); value != test.expected {
+			t.Errorf("%v: got %v, expected %v", test.name, value, test.expected)
+		}
+	}
+}
+
+func TestEventJoystickMonitorResync(t *testing.T) {
+	const btnSouth, btnEast = btnGamepad, btnGamepad + 1
+	var deviceKeys [keyCnt / 8]byte
+	deviceKeys[btnSouth/8] |= 1 << (btnSouth % 8)
+	deviceAxes := map[uint16]int32{absX: 0}
+	queries := 0
+	m := &eventJoystickMonitor{
+		JoystickMonitor: JoystickMonitor{Device: &Device{Path: "/dev/input/event0"}},
+		config:          NewConfig(),
+		axis:            make(map[uint16]joystickAxis),
+		queryKeys: func(keys *[keyCnt / 8]byte) error {
+			queries++
+			*keys = deviceKeys
+			return nil
+		},
+		absinfo: func(code uint16) (inputAbsinfo, error) {
+			return inputAbsinfo{Value: deviceAxes[code], Minimum: -100, Maximum: 100}, nil
+		},
+	}
+	// Pressed before events were dropped
+	m.keys[btnEast/8] |= 1 << (btnEast % 8)
+	var events []ActivityEvent
+	m.emit = func(event ActivityEvent) { events = append(events, event) }
+	for _, test := range []struct {
+		name     string
+		event    inputEvent
+		expected []ActivityEvent
+	}{
+		{"initial axis", inputEvent{Type: evAbs, Code: absX, Value: 0}, nil},
+		{"dropped", inputEvent{Type: evSyn, Code: synDropped}, nil},
+		{"discarded button", inputEvent{Type: evKey, Code: btnSouth, Value: 1}, nil},
+		{"discarded axis", inputEvent{Type: evAbs, Code: absX, Value: 90}, nil},
+		{"resync", inputEvent{Type: evSyn, Code: synReport}, []ActivityEvent{
+			{Kind: KindButton, Code: btnSouth, Value: 1},
+			{Kind: KindButton, Code: btnEast, Value: 0},
+			{Kind: KindAxis, Code: absX, Value: 90},
+		}},
+		{"after resync", inputEvent{Type: evKey, Code: btnSouth, Value: 0}, []ActivityEvent{
+			{Kind: KindButton, Code: btnSouth, Value: 0},
+		}},
+	} {
+		if test.name == "resync" {
+			deviceAxes[absX] = 90
+		}
+		events = nil
+		if err := m.handleEvent(&test.event); err != nil {
+			t.Fatal(err)
+		}
+		var got []ActivityEvent
+		for _, event := range events {
+			got = append(got, ActivityEvent{Kind: event.Kind, Code: event.Code, Value: event.Value})
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%v: got %v, expected %v", test.name, got, test.expected)
+		}
+	}
+	if queries != 1 {
+		t.Errorf("keys queried %d times, expected 1", queries)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"os"
+	"time"
+	"unsafe"
+)
+
+const hidMaxDescriptorSize = 4096
+
+type hidrawReportDescriptor struct {
+	Size  uint32
+	Value [hidMaxDescriptorSize]byte
+}
+
+type hidrawFieldState struct {
+	set   bool
+	axis  joystickAxis
+	value int32
+}
+
+type hidrawJoystickMonitor struct {
+	JoystickMonitor
+	config     *Config
+	descriptor *hidDescriptor
+	state      []hidrawFieldState
+}
+
+func NewHidrawJoystickMonitor(joystick *os.File, device *Device, config *Config) (*JoystickMonitor, error) {
+	var size int32
+	if err := ioctl(joystick, "HIDIOCGRDESCSIZE", ioc(iocRead, 'H', 0x01, unsafe.Sizeof(size)), unsafe.Pointer(&size)); err != nil {
+		return nil, err
+	}
+	rawDescriptor := hidrawReportDescriptor{Size: uint32(size)}
+	if rawDescriptor.Size > hidMaxDescriptorSize {
+		rawDescriptor.Size = hidMaxDescriptorSize
+	}
+	if err := ioctl(joystick, "HIDIOCGRDESC", ioc(iocRead, 'H', 0x02, unsafe.Sizeof(rawDescriptor)), unsafe.Pointer(&rawDescriptor)); err != nil {
+		return nil, err
+	}
+	descriptor, err := parseHidDescriptor(rawDescriptor.Value[:rawDescriptor.Size])
+	if err != nil {
+		return nil, err
+	}
+	m := &hidrawJoystickMonitor{
+		JoystickMonitor: newJoystickMonitor(joystick, device),
+		config:          config,
+		descriptor:      descriptor,
+		state:           make([]hidrawFieldState, len(descriptor.fields)),
+	}
+	m.JoystickMonitor.parse = m.handleReport
+	return &m.JoystickMonitor, nil
+}
+
+// handleReport handles one input report, the values of the first report
+// are used as the initial state
+func (m *hidrawJoystickMonitor) handleReport(report []byte) error {
+	t := time.Duration(time.Now().UnixNano())
+	var reportID uint8
+	if m.descriptor.reportIDs && len(report) > 0 {
+		reportID, report = report[0], report[1:]
+	}
+	for i := range m.descriptor.fields {
+		field, state := &m.descriptor.fields[i], &m.state[i]
+		if field.reportID != reportID {
+			continue
+		}
+		value, ok := field.value(report)
+		if !ok {
+			continue
+		}
+		if field.control.typ == evAbs && absKind(field.control.code) == KindAxis {
+			if !state.set {
+				absinfo := inputAbsinfo{Minimum: field.min, Maximum: field.max}
+				state.axis = newJoystickAxis(absinfo, m.config, m.Device, field.control.code, value)
+			} else if value, ok := state.axis.update(value); ok {
+				m.activity(KindAxis, field.control.code, value, t)
+			}
+		} else if state.set && value != state.value {
+			// Buttons and hat switches count if they change
+			kind := KindButton
+			if field.control.typ == evAbs {
+				kind = KindHat
+			}
+			m.activity(kind, field.control.code, value, t)
+		}
+		state.value = value
+		state.set = true
+	}
+	return nil
+}
+
+func (m *hidrawJoystickMonitor) activity(kind ActivityKind, code uint16, value int32, t time.Duration) {
+	m.emit(ActivityEvent{
+		Device: m.Device,
+		Kind:   kind,
+		Code:   code,
+		Value:  value,
+		Time:   t,
+	})
+}
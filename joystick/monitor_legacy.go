@@ -24,6 +24,7 @@ import (
 	"io"
 	"math"
 	"os"
+	"time"
 	"unsafe"
 )
 
@@ -40,68 +41,108 @@ const (
 	jsEventInit   = 0x80
 )
 
+// The kernel scales the values of axes to this range
+var legacyAbsinfo = inputAbsinfo{Minimum: -32767, Maximum: 32767}
+
 type legacyJoystickAxis struct {
+	threshold uint16
+	deadzone  uint16
+	// Center of the deadzone, the minimum for triggers and pedals
+	center   int16
 	min, max int16
 }
 
 type legacyJoystickMonitor struct {
 	JoystickMonitor
-	axis map[uint8]legacyJoystickAxis
+	config *Config
+	axmap  [absCnt]uint8
+	btnmap [keyCnt - btnMisc]uint16
+	axis   map[uint8]legacyJoystickAxis
 }
 
-func NewLegacyJoystickMonitor(joystick *os.File) *JoystickMonitor {
-	chanC := make(chan struct{})
-	chanE := make(chan error)
+func NewLegacyJoystickMonitor(joystick *os.File, device *Device, config *Config) *JoystickMonitor {
+	queriedDevice := *device
+	queriedDevice.queryLegacy(joystick)
 	m := &legacyJoystickMonitor{
-		JoystickMonitor: JoystickMonitor{joystick, chanC, chanC, chanE, chanE},
+		JoystickMonitor: newJoystickMonitor(joystick, &queriedDevice),
+		config:          config,
 		axis:            make(map[uint8]legacyJoystickAxis),
 	}
-	go m.task()
+	if err := ioctl(joystick, "JSIOCGAXMAP", ioc(iocRead, 'j', 0x32, unsafe.Sizeof(m.axmap)), unsafe.Pointer(&m.axmap)); err != nil {
+		for i := range m.axmap {
+			m.axmap[i] = uint8(i)
+		}
+	}
+	if err := ioctl(joystick, "JSIOCGBTNMAP", ioc(iocRead, 'j', 0x34, unsafe.Sizeof(m.btnmap)), unsafe.Pointer(&m.btnmap)); err != nil {
+		for i := range m.btnmap {
+			m.btnmap[i] = uint16(i)
+		}
+	}
+	m.JoystickMonitor.parse = m.handleEvents
 	return &m.JoystickMonitor
 }
 
-func (m *legacyJoystickMonitor) task() {
-	var buf [4096]byte
-	for {
-		size, err := m.joystick.Read(buf[:])
-		if err != nil {
-			m.e <- err
-			return
+func (m *legacyJoystickMonitor) activity(kind ActivityKind, code uint16, event *jsEvent, value int16) {
+	m.emit(ActivityEvent{
+		Device: m.Device,
+		Kind:   kind,
+		Code:   code,
+		Value:  int32(value),
+		Time:   time.Duration(event.Time) * time.Millisecond,
+	})
+}
+
+func (m *legacyJoystickMonitor) handleEvents(eventsData []byte) error {
+	for len(eventsData) > 0 {
+		if len(eventsData) < int(unsafe.Sizeof(jsEvent{})) {
+			return fmt.Errorf("read %v: %w", m.joystick.Name(), io.ErrUnexpectedEOF)
 		}
-		eventsData := buf[:size]
-		for {
-			if len(eventsData) < int(unsafe.Sizeof(jsEvent{})) {
-				m.e <- fmt.Errorf("read %v: %w", m.joystick.Name(), io.ErrUnexpectedEOF)
-				return
+		event := (*jsEvent)(unsafe.Pointer(&eventsData[0]))
+		eventsData = eventsData[int(unsafe.Sizeof(jsEvent{})):]
+		if event.Type&jsEventAxis != 0 {
+			code := uint16(event.Number)
+			if int(event.Number) < len(m.axmap) {
+				code = uint16(m.axmap[event.Number])
 			}
-			event := (*jsEvent)(unsafe.Pointer(&eventsData[0]))
-			eventsData = eventsData[int(unsafe.Sizeof(jsEvent{})):]
-			if event.Type&jsEventAxis != 0 {
-				state, stateSet := m.axis[event.Number]
-				if !stateSet || event.Type&jsEventInit != 0 {
-					state.min = event.Value
-					state.max = event.Value
-				} else {
-					if event.Value < state.min {
-						state.min = event.Value
-					}
-					if event.Value > state.max {
-						state.max = event.Value
-					}
-					if uint16(state.max-state.min) > math.MaxUint16/8 {
-						state.min = event.Value
-						state.max = event.Value
-						m.c <- struct{}{}
-					}
+			state, stateSet := m.axis[event.Number]
+			if !stateSet {
+				c := control{evAbs, code}
+				state.threshold = uint16(scaleThreshold(math.MaxUint16, m.config.AxisThreshold.get(m.Device, c)))
+				state.deadzone = uint16(scaleThreshold(math.MaxUint16, m.config.Deadzone.get(m.Device, c)))
+				if isOneSided(legacyAbsinfo, code, int32(event.Value)) {
+					state.center = int16(legacyAbsinfo.Minimum)
 				}
-				m.axis[event.Number] = state
 			}
-			if event.Type == jsEventButton {
-				m.c <- struct{}{}
+			// The kernel already applies the correction of the driver
+			value := event.Value
+			if abs32(int32(value)-int32(state.center)) <= uint32(state.deadzone) {
+				value = state.center
+			}
+			if !stateSet || event.Type&jsEventInit != 0 {
+				state.min = value
+				state.max = value
+			} else {
+				if value < state.min {
+					state.min = value
+				}
+				if value > state.max {
+					state.max = value
+				}
+				if uint16(state.max-state.min) > state.threshold {
+					state.min = value
+					state.max = value
+					m.activity(absKind(code), code, event, value)
+				}
 			}
-			if len(eventsData) == 0 {
-				break
+			m.axis[event.Number] = state
+		}
+		if event.Type == jsEventButton {
+			code := uint16(event.Number)
+			if int(event.Number) < len(m.btnmap) {
+				code = m.btnmap[event.Number]
 			}
+			m.activity(KindButton, code, event, event.Value)
 		}
 	}
+	return nil
 }
@@ -0,0 +1,64 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestLegacyJoystickMonitorDeadzone(t *testing.T) {
+	config := NewConfig()
+	for flag, value := range map[*ControlSetting]string{&config.AxisThreshold: "0.1", &config.Deadzone: "0.2"} {
+		if err := flag.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &legacyJoystickMonitor{
+		JoystickMonitor: JoystickMonitor{Device: &Device{Path: "/dev/input/js0"}},
+		config:          config,
+		axis:            make(map[uint8]legacyJoystickAxis),
+	}
+	m.axmap[0], m.axmap[1] = absX, absRz
+	var values []int32
+	m.emit = func(event ActivityEvent) { values = append(values, event.Value) }
+	for _, test := range []struct {
+		name     string
+		event    jsEvent
+		expected []int32
+	}{
+		{"initial stick", jsEvent{Type: jsEventAxis | jsEventInit, Number: 0, Value: 0}, nil},
+		{"initial trigger", jsEvent{Type: jsEventAxis | jsEventInit, Number: 1, Value: -32767}, nil},
+		{"stick in deadzone", jsEvent{Type: jsEventAxis, Number: 0, Value: 10000}, nil},
+		{"trigger in deadzone", jsEvent{Type: jsEventAxis, Number: 1, Value: -25000}, nil},
+		{"trigger", jsEvent{Type: jsEventAxis, Number: 1, Value: 0}, []int32{0}},
+		{"trigger in center", jsEvent{Type: jsEventAxis, Number: 1, Value: 10000}, []int32{10000}},
+	} {
+		values = nil
+		data := (*[unsafe.Sizeof(jsEvent{})]byte)(unsafe.Pointer(&test.event))[:]
+		if err := m.handleEvents(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("%v: got %v, expected %v", test.name, values, test.expected)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"log"
+	"time"
+)
+
+// Number of consecutive intervals of equal length after which input counts
+// as periodic
+const periodicCount = 6
+
+type periodicKey struct {
+	control nodeControl
+	value   int32
+}
+
+type periodicState struct {
+	last, interval time.Duration
+	count          int
+}
+
+// periodicDetector ignores buttons and hats that repeat the same value at
+// near-constant intervals, e.g. turbo buttons and anti-idle macros
+type periodicDetector struct {
+	config    *Config
+	tolerance map[nodeControl]time.Duration
+	states    map[periodicKey]periodicState
+}
+
+func newPeriodicDetector(config *Config) *periodicDetector {
+	return &periodicDetector{
+		config:    config,
+		tolerance: make(map[nodeControl]time.Duration),
+		states:    make(map[periodicKey]periodicState),
+	}
+}
+
+// filter returns false if the event belongs to periodic input
+func (d *periodicDetector) filter(event *ActivityEvent) bool {
+	if event.Kind == KindAxis {
+		return true
+	}
+	c := nodeControl{event.Device, eventControl(event)}
+	tolerance, found := d.tolerance[c]
+	if !found {
+		tolerance = time.Duration(d.config.PeriodicTolerance.get(event.Device, c.control) * float64(time.Second))
+		d.tolerance[c] = tolerance
+	}
+	if tolerance <= 0 {
+		return true
+	}
+	key := periodicKey{c, event.Value}
+	state, found := d.states[key]
+	if found {
+		interval := event.Time - state.last
+		if deviation := interval - state.interval; state.count > 0 && deviation <= tolerance && -deviation <= tolerance {
+			state.count++
+		} else {
+			if state.count >= periodicCount {
+				log.Printf("%v: %v=%v is no longer periodic\n", event.origin(), c, event.Value)
+			}
+			state.count = 1
+			state.interval = interval
+		}
+	}
+	state.last = event.Time
+	d.states[key] = state
+	if state.count < periodicCount {
+		return true
+	}
+	if state.count == periodicCount {
+		log.Printf("%v: ignore %v=%v, repeats every %v\n", event.origin(), c, event.Value, state.interval)
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodicDetector(t *testing.T) {
+	config := NewConfig()
+	if err := config.PeriodicTolerance.Set("Turbo Pad=0"); err != nil {
+		t.Fatal(err)
+	}
+	device := &Device{Name: "Gamepad"}
+	press := func(device *Device, ms int) *ActivityEvent {
+		return &ActivityEvent{Device: device, Kind: KindButton, Code: btnJoystick, Value: 1, Time: time.Duration(ms) * time.Millisecond}
+	}
+	d := newPeriodicDetector(config)
+	for i := 0; i < 10; i++ {
+		expected := i < periodicCount
+		if result := d.filter(press(device, 1000*i+i%2*3)); result != expected {
+			t.Errorf("periodic press %v: got %v, expected %v", i, result, expected)
+		}
+	}
+	if !d.filter(press(device, 10500)) {
+		t.Error("irregular press ignored")
+	}
+	d = newPeriodicDetector(config)
+	for i, ms := range []int{0, 400, 900, 1200, 1800, 2100, 2500, 3100, 3400} {
+		if !d.filter(press(device, ms)) {
+			t.Errorf("human press %v ignored", i)
+		}
+	}
+	d = newPeriodicDetector(config)
+	turbo := &Device{Name: "Turbo Pad"}
+	for i := 0; i < 10; i++ {
+		if !d.filter(press(turbo, 100*i)) {
+			t.Errorf("press %v of device without detection ignored", i)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"sync"
+)
+
+// ActivityQueue passes activity and errors of controller monitors to another
+// goroutine. Only the latest event of each controller is kept until the
+// queue is taken.
+type ActivityQueue struct {
+	mutex  sync.Mutex
+	events []ActivityEvent
+	index  map[*ControllerMonitor]int
+	errors map[*ControllerMonitor]error
+
+	// Take must be called after receiving from C
+	c chan struct{}
+	C <-chan struct{}
+}
+
+func NewActivityQueue() *ActivityQueue {
+	chanC := make(chan struct{}, 1)
+	return &ActivityQueue{
+		index:  make(map[*ControllerMonitor]int),
+		errors: make(map[*ControllerMonitor]error),
+		c:      chanC,
+		C:      chanC,
+	}
+}
+
+func (q *ActivityQueue) notify() {
+	select {
+	case q.c <- struct{}{}:
+	default:
+	}
+}
+
+func (q *ActivityQueue) push(m *ControllerMonitor, event ActivityEvent) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if i, found := q.index[m]; found {
+		q.events[i] = event
+		return
+	}
+	q.index[m] = len(q.events)
+	q.events = append(q.events, event)
+	q.notify()
+}
+
+func (q *ActivityQueue) fail(m *ControllerMonitor, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, found := q.errors[m]; !found {
+		q.errors[m] = err
+	}
+	q.notify()
+}
+
+// Take returns and removes the queued events and errors
+func (q *ActivityQueue) Take() ([]ActivityEvent, map[*ControllerMonitor]error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	events, errors := q.events, q.errors
+	q.events = nil
+	q.index = make(map[*ControllerMonitor]int)
+	q.errors = make(map[*ControllerMonitor]error)
+	return events, errors
+}
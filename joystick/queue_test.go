@@ -0,0 +1,54 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestActivityQueue(t *testing.T) {
+	q := NewActivityQueue()
+	m1, m2 := &ControllerMonitor{}, &ControllerMonitor{}
+	q.push(m1, ActivityEvent{Code: 1})
+	q.push(m2, ActivityEvent{Code: 2})
+	q.push(m1, ActivityEvent{Code: 3})
+	q.fail(m2, errors.New("test"))
+	select {
+	case <-q.C:
+	default:
+		t.Fatal("not notified")
+	}
+	select {
+	case <-q.C:
+		t.Fatal("notified twice")
+	default:
+	}
+	events, errs := q.Take()
+	if len(events) != 2 || events[0].Code != 3 || events[1].Code != 2 {
+		t.Errorf("got events %v", events)
+	}
+	if len(errs) != 1 || errs[m2] == nil {
+		t.Errorf("got errors %v", errs)
+	}
+	if events, errs := q.Take(); len(events) != 0 || len(errs) != 0 {
+		t.Error("queue not empty")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var controlNames = map[string]control{
+	"ABS_X":          {evAbs, 0x00},
+	"ABS_Y":          {evAbs, 0x01},
+	"ABS_Z":          {evAbs, 0x02},
+	"ABS_RX":         {evAbs, 0x03},
+	"ABS_RY":         {evAbs, 0x04},
+	"ABS_RZ":         {evAbs, 0x05},
+	"ABS_THROTTLE":   {evAbs, 0x06},
+	"ABS_RUDDER":     {evAbs, 0x07},
+	"ABS_WHEEL":      {evAbs, 0x08},
+	"ABS_GAS":        {evAbs, 0x09},
+	"ABS_BRAKE":      {evAbs, 0x0a},
+	"ABS_HAT0X":      {evAbs, 0x10},
+	"ABS_HAT0Y":      {evAbs, 0x11},
+	"ABS_HAT1X":      {evAbs, 0x12},
+	"ABS_HAT1Y":      {evAbs, 0x13},
+	"ABS_HAT2X":      {evAbs, 0x14},
+	"ABS_HAT2Y":      {evAbs, 0x15},
+	"ABS_HAT3X":      {evAbs, 0x16},
+	"ABS_HAT3Y":      {evAbs, 0x17},
+	"ABS_PRESSURE":   {evAbs, 0x18},
+	"ABS_DISTANCE":   {evAbs, 0x19},
+	"ABS_TILT_X":     {evAbs, 0x1a},
+	"ABS_TILT_Y":     {evAbs, 0x1b},
+	"ABS_TOOL_WIDTH": {evAbs, 0x1c},
+	"ABS_VOLUME":     {evAbs, 0x20},
+	"ABS_MISC":       {evAbs, 0x28},
+	"BTN_TRIGGER":    {evKey, 0x120},
+	"BTN_THUMB":      {evKey, 0x121},
+	"BTN_THUMB2":     {evKey, 0x122},
+	"BTN_TOP":        {evKey, 0x123},
+	"BTN_TOP2":       {evKey, 0x124},
+	"BTN_PINKIE":     {evKey, 0x125},
+	"BTN_BASE":       {evKey, 0x126},
+	"BTN_BASE2":      {evKey, 0x127},
+	"BTN_BASE3":      {evKey, 0x128},
+	"BTN_BASE4":      {evKey, 0x129},
+	"BTN_BASE5":      {evKey, 0x12a},
+	"BTN_BASE6":      {evKey, 0x12b},
+	"BTN_DEAD":       {evKey, 0x12f},
+	"BTN_SOUTH":      {evKey, 0x130},
+	"BTN_A":          {evKey, 0x130},
+	"BTN_EAST":       {evKey, 0x131},
+	"BTN_B":          {evKey, 0x131},
+	"BTN_C":          {evKey, 0x132},
+	"BTN_NORTH":      {evKey, 0x133},
+	"BTN_X":          {evKey, 0x133},
+	"BTN_WEST":       {evKey, 0x134},
+	"BTN_Y":          {evKey, 0x134},
+	"BTN_Z":          {evKey, 0x135},
+	"BTN_TL":         {evKey, 0x136},
+	"BTN_TR":         {evKey, 0x137},
+	"BTN_TL2":        {evKey, 0x138},
+	"BTN_TR2":        {evKey, 0x139},
+	"BTN_SELECT":     {evKey, 0x13a},
+	"BTN_START":      {evKey, 0x13b},
+	"BTN_MODE":       {evKey, 0x13c},
+	"BTN_THUMBL":     {evKey, 0x13d},
+	"BTN_THUMBR":     {evKey, 0x13e},
+	"BTN_DPAD_UP":    {evKey, 0x220},
+	"BTN_DPAD_DOWN":  {evKey, 0x221},
+	"BTN_DPAD_LEFT":  {evKey, 0x222},
+	"BTN_DPAD_RIGHT": {evKey, 0x223},
+}
+
+// control identifies an axis or button by its evdev type and code.
+// The type 0 matches all types.
+type control struct {
+	typ, code uint16
+}
+
+func parseControl(s string) (control, error) {
+	if c, found := controlNames[strings.ToUpper(s)]; found {
+		return c, nil
+	}
+	code, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return control{}, fmt.Errorf("invalid control: %q", s)
+	}
+	return control{0, uint16(code)}, nil
+}
+
+// isControlName checks if the string looks like the name of an axis or button
+func isControlName(s string) bool {
+	s = strings.ToUpper(s)
+	return strings.HasPrefix(s, "ABS_") || strings.HasPrefix(s, "BTN_")
+}
+
+func (c control) String() string {
+	name := ""
+	for n, other := range controlNames {
+		if other == c && (name == "" || n < name) {
+			name = n
+		}
+	}
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("%#x", c.code)
+}
+
+func (c control) matches(other control) bool {
+	return c.code == other.code && (c.typ == 0 || other.typ == 0 || c.typ == other.typ)
+}
+
+type settingRule struct {
+	device     string
+	control    control
+	hasControl bool
+	value      float64
+}
+
+// ControlSetting is a flag.Value with a default that can be overridden for
+// devices and controls with rules of the form [DEVICE][/CONTROL]=VALUE.
+// DEVICE is the name of the device or VENDOR:PRODUCT in hexadecimal.
+// CONTROL is the name (e.g. ABS_RX) or number of an axis or button, other
+// suffixes after "/" are part of DEVICE.
+type ControlSetting struct {
+	Default float64
+	rules   []settingRule
+}
+
+func (s *ControlSetting) String() string {
+	if s == nil {
+		return ""
+	}
+	values := []string{strconv.FormatFloat(s.Default, 'g', -1, 64)}
+	for _, rule := range s.rules {
+		match := rule.device
+		if rule.hasControl {
+			match += fmt.Sprintf("/%#x", rule.control.code)
+		}
+		values = append(values, match+"="+strconv.FormatFloat(rule.value, 'g', -1, 64))
+	}
+	return strings.Join(values, " ")
+}
+
+func (s *ControlSetting) Set(value string) error {
+	match, valueString, hasMatch := cutLast(value, "=")
+	if !hasMatch {
+		valueString = value
+	}
+	v, err := strconv.ParseFloat(valueString, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value: %q", valueString)
+	}
+	if v < 0 {
+		return fmt.Errorf("negative value: %v", v)
+	}
+	if !hasMatch {
+		s.Default = v
+		return nil
+	}
+	rule := settingRule{device: match, value: v}
+	// Names of devices can contain "/", the suffix is only a control if it
+	// names one
+	if device, controlString, found := cutLast(match, "/"); found {
+		if c, err := parseControl(controlString); err == nil {
+			rule.device, rule.control, rule.hasControl = device, c, true
+		} else if isControlName(controlString) {
+			return err
+		}
+	}
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// get returns the value of the most specific rule, later rules take
+// precedence over earlier rules with the same specificity.
+func (s *ControlSetting) get(device *Device, c control) float64 {
+	value, bestScore := s.Default, 0
+	for _, rule := range s.rules {
+		score := 1
+		if rule.device != "" {
+			if !device.matches(rule.device) {
+				continue
+			}
+			score += 2
+		}
+		if rule.hasControl {
+			if !rule.control.matches(c) {
+				continue
+			}
+			score++
+		}
+		if score >= bestScore {
+			value, bestScore = rule.value, score
+		}
+	}
+	return value
+}
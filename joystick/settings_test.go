@@ -0,0 +1,84 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"testing"
+)
+
+func TestControlSetting(t *testing.T) {
+	var s ControlSetting
+	for _, value := range []string{
+		"0.125",
+		"/ABS_RX=0.2",
+		"Xbox Wireless Controller=0.3",
+		"045E:0B13/abs_rx=0.4",
+		"Flight Stick/0x1=0.05",
+		"USB Gamepad/Joystick=0.6",
+	} {
+		if err := s.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	xbox := &Device{Name: "Xbox Wireless Controller", Vendor: 0x045e, Product: 0x0b13}
+	stick := &Device{Name: "Flight Stick", Vendor: 0x1234, Product: 0x5678}
+	slashed := &Device{Name: "USB Gamepad/Joystick", Vendor: 0x0079, Product: 0x0006}
+	for _, test := range []struct {
+		device   *Device
+		control  control
+		expected float64
+	}{
+		{stick, control{evAbs, 0x00}, 0.125},
+		{stick, control{evAbs, 0x01}, 0.05},
+		{stick, control{evKey, 0x01}, 0.05},
+		{stick, control{evAbs, 0x03}, 0.2},
+		{xbox, control{evAbs, 0x00}, 0.3},
+		{xbox, control{evAbs, 0x03}, 0.4},
+		{xbox, control{evKey, 0x03}, 0.3},
+		{slashed, control{evAbs, 0x00}, 0.6},
+		{slashed, control{evAbs, 0x03}, 0.6},
+	} {
+		if value := s.get(test.device, test.control); value != test.expected {
+			t.Errorf("%v %v: got %v, expected %v", test.device.Name, test.control, value, test.expected)
+		}
+	}
+	for _, value := range []string{"", "x", "-1", "dev/ABS_UNKNOWN=1", "dev=abc"} {
+		if err := s.Set(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
+
+func TestMotionEnabled(t *testing.T) {
+	config := NewConfig()
+	sensor := &Device{Name: "Wireless Controller Motion Sensors", Class: ClassMotionSensor}
+	if config.MotionEnabled(sensor) {
+		t.Error("enabled by default")
+	}
+	if err := config.MotionThreshold.Set("Wireless Controller Motion Sensors/ABS_RZ=30"); err != nil {
+		t.Fatal(err)
+	}
+	if !config.MotionEnabled(sensor) {
+		t.Error("not enabled for axis")
+	}
+	if config.MotionEnabled(&Device{Name: "Other Motion Sensors", Class: ClassMotionSensor}) {
+		t.Error("enabled for other device")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Activity of a control with longer pauses ends its streak
+const stuckGap = 10 * time.Second
+
+// nodeControl identifies a control of one input node of a controller
+type nodeControl struct {
+	device *Device
+	control
+}
+
+type stuckStreak struct {
+	start, last time.Duration
+	controls    map[nodeControl]struct{}
+}
+
+// stuckDetector quarantines controls that are the only source of activity
+// for longer than the timeout, e.g. a chattering button or a drifting stick.
+// Both axes of a stick count as the same source. Any other control releases
+// the quarantine.
+type stuckDetector struct {
+	timeout     time.Duration
+	streak      stuckStreak
+	source      nodeControl
+	quarantined map[nodeControl]struct{}
+}
+
+func newStuckDetector(timeout time.Duration) *stuckDetector {
+	return &stuckDetector{timeout: timeout}
+}
+
+func eventControl(event *ActivityEvent) control {
+	if event.Kind == KindButton {
+		return control{evKey, event.Code}
+	}
+	return control{evAbs, event.Code}
+}
+
+// stickSource returns the first axis of the stick or hat, other controls are
+// their own source
+func stickSource(c control) control {
+	if c.typ != evAbs {
+		return c
+	}
+	switch {
+	case c.code == absY:
+		return control{evAbs, absX}
+	case c.code == absRy:
+		return control{evAbs, absRx}
+	case c.code >= absHat0x && c.code <= absHat3y:
+		return control{evAbs, c.code &^ 1}
+	}
+	return c
+}
+
+func controlList(controls map[nodeControl]struct{}) string {
+	var names []string
+	for c := range controls {
+		names = append(names, c.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// filter returns false if the event belongs to a quarantined control
+func (d *stuckDetector) filter(event *ActivityEvent) bool {
+	if d.timeout <= 0 {
+		return true
+	}
+	c := nodeControl{event.Device, eventControl(event)}
+	source := nodeControl{event.Device, stickSource(c.control)}
+	if d.quarantined != nil {
+		if _, found := d.quarantined[c]; found {
+			return false
+		}
+		log.Printf("%v: release [%v], %v shows other input\n", event.origin(), controlList(d.quarantined), c)
+		d.quarantined = nil
+	}
+	if d.streak.controls == nil || source != d.source || event.Time-d.streak.last > stuckGap {
+		d.source = source
+		d.streak = stuckStreak{start: event.Time, controls: make(map[nodeControl]struct{})}
+	}
+	d.streak.last = event.Time
+	d.streak.controls[c] = struct{}{}
+	if event.Time-d.streak.start < d.timeout {
+		return true
+	}
+	d.quarantined = d.streak.controls
+	d.streak = stuckStreak{}
+	log.Printf("%v: quarantine [%v], no other input for %v\n", event.origin(), controlList(d.quarantined), d.timeout)
+	return false
+}
@@ -0,0 +1,65 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStuckDetector(t *testing.T) {
+	device := &Device{Path: "/dev/input/event0"}
+	event := func(kind ActivityKind, code uint16, seconds int) *ActivityEvent {
+		return &ActivityEvent{Device: device, Kind: kind, Code: code, Time: time.Duration(seconds) * time.Second}
+	}
+	for _, test := range []struct {
+		name     string
+		events   []*ActivityEvent
+		expected []bool
+	}{
+		{"drifting axis", []*ActivityEvent{
+			event(KindAxis, absX, 0), event(KindAxis, absX, 5), event(KindAxis, absX, 10),
+			event(KindAxis, absX, 15), event(KindAxis, absY, 16),
+		}, []bool{true, true, true, false, true}},
+		{"drifting stick", []*ActivityEvent{
+			event(KindAxis, absX, 0), event(KindAxis, absY, 5), event(KindAxis, absX, 10),
+			event(KindAxis, absY, 15), event(KindAxis, absX, 16), event(KindButton, btnJoystick, 17),
+			event(KindAxis, absX, 18),
+		}, []bool{true, true, true, false, false, true, true}},
+		{"other input", []*ActivityEvent{
+			event(KindAxis, absX, 0), event(KindAxis, absX, 5), event(KindButton, btnJoystick, 6),
+			event(KindAxis, absX, 10), event(KindAxis, absX, 15),
+		}, []bool{true, true, true, true, true}},
+		{"pause", []*ActivityEvent{
+			event(KindButton, btnJoystick, 0), event(KindButton, btnJoystick, 11),
+			event(KindButton, btnJoystick, 20), event(KindButton, btnJoystick, 30),
+		}, []bool{true, true, true, false}},
+	} {
+		d := newStuckDetector(15 * time.Second)
+		for i, e := range test.events {
+			if result := d.filter(e); result != test.expected[i] {
+				t.Errorf("%v: event %v: got %v, expected %v", test.name, i, result, test.expected[i])
+			}
+		}
+	}
+	if d := newStuckDetector(0); !d.filter(event(KindAxis, absX, 0)) || !d.filter(event(KindAxis, absX, 3600)) {
+		t.Error("disabled detector filtered events")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"github.com/unrud/joystick-monitor/processes"
+	"sort"
+	"strings"
+)
+
+// UinputPath is held open by processes that create virtual devices
+const UinputPath = "/dev/uinput"
+
+// IsVirtual checks if the device was created through uinput
+func (d *Device) IsVirtual() bool {
+	return d.BusType == BusVirtual || strings.HasPrefix(d.SysfsPath, sysfsVirtualInputDir+"/")
+}
+
+func namesMatch(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return a != "" && b != "" && (strings.Contains(a, b) || strings.Contains(b, a))
+}
+
+// LinkVirtualDevices finds the processes that created the virtual devices
+// and the physical devices they forward. holders contains the processes
+// that have the devices and UinputPath open. Virtual devices are
+// linked if the physical device can be identified unambiguously by name or
+// because the creator holds a single physical controller.
+func LinkVirtualDevices(devices map[string]*Device, holders map[string][]*processes.Process) {
+	physical := make(map[int][]*Device)
+	physicalIDs := controllerIDs(devices)
+	for devicePath, d := range devices {
+		if d.IsVirtual() {
+			continue
+		}
+		for _, p := range holders[devicePath] {
+			physical[p.Pid] = append(physical[p.Pid], d)
+		}
+	}
+	for _, d := range devices {
+		if !d.IsVirtual() {
+			continue
+		}
+		d.Creator, d.PhysicalID = nil, ""
+		var candidates []*processes.Process
+		for _, p := range holders[UinputPath] {
+			if len(physical[p.Pid]) > 0 {
+				candidates = append(candidates, p)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Pid < candidates[j].Pid })
+		var matches []*Device
+		for _, creator := range candidates {
+			for _, p := range physical[creator.Pid] {
+				if namesMatch(d.Name, p.Name) {
+					if len(matches) == 0 || d.Creator == creator {
+						d.Creator = creator
+						matches = append(matches, p)
+					}
+				}
+			}
+		}
+		if len(matches) == 0 && len(candidates) == 1 {
+			d.Creator = candidates[0]
+			matches = physical[d.Creator.Pid]
+		}
+		ids := make(map[string]struct{})
+		for _, p := range matches {
+			ids[physicalIDs[p]] = struct{}{}
+		}
+		if len(ids) == 1 {
+			d.PhysicalID = physicalIDs[matches[0]]
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package joystick
+
+import (
+	"github.com/unrud/joystick-monitor/processes"
+	"testing"
+)
+
+func TestLinkVirtualDevices(t *testing.T) {
+	const (
+		dualSenseID = "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-1/1-1:1.3/0003:054C:0CE6.0001"
+		xboxID      = "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0"
+	)
+	steam := &processes.Process{Pid: 100, Comm: "steam"}
+	remapper := &processes.Process{Pid: 200, Comm: "input-remapper-"}
+	game := &processes.Process{Pid: 300, Comm: "game"}
+	newDevices := func() map[string]*Device {
+		devices := make(map[string]*Device)
+		for _, d := range []*Device{
+			{Path: "/dev/hidraw3", Name: "Sony Interactive Entertainment DualSense Wireless Controller", SysfsPath: dualSenseID},
+			{Path: "/dev/input/event10", Name: "Microsoft X-Box One S pad", BusType: BusUSB, SysfsPath: xboxID + "/input/input10"},
+			{Path: "/dev/input/event20", Name: "Microsoft X-Box 360 pad 0", BusType: BusVirtual, SysfsPath: sysfsVirtualInputDir + "/input20"},
+			{Path: "/dev/input/event21", Name: "input-remapper Microsoft X-Box One S pad forwarded", BusType: BusVirtual, SysfsPath: sysfsVirtualInputDir + "/input21"},
+		} {
+			devices[d.Path] = d
+		}
+		return devices
+	}
+
+	devices := newDevices()
+	LinkVirtualDevices(devices, map[string][]*processes.Process{
+		"/dev/hidraw3":       {steam},
+		"/dev/input/event10": {remapper},
+		"/dev/input/event20": {game},
+		"/dev/input/event21": {game},
+		UinputPath:           {steam, remapper},
+	})
+	for path, expected := range map[string]struct {
+		creator *processes.Process
+		id      string
+	}{
+		"/dev/input/event20": {nil, ""},
+		"/dev/input/event21": {remapper, xboxID},
+	} {
+		if d := devices[path]; d.Creator != expected.creator || d.PhysicalID != expected.id {
+			t.Errorf("%v: got %v %q, expected %v %q", path, d.Creator, d.PhysicalID, expected.creator, expected.id)
+		}
+	}
+
+	devices = newDevices()
+	delete(devices, "/dev/input/event10")
+	delete(devices, "/dev/input/event21")
+	LinkVirtualDevices(devices, map[string][]*processes.Process{
+		"/dev/hidraw3":       {steam},
+		"/dev/input/event20": {game},
+		UinputPath:           {steam},
+	})
+	if d := devices["/dev/input/event20"]; d.Creator != steam || d.PhysicalID != dualSenseID {
+		t.Errorf("single creator: got %v %q", d.Creator, d.PhysicalID)
+	}
+	controllers := GroupDevices(map[string]*Device{"/dev/hidraw3": devices["/dev/hidraw3"], "/dev/input/event20": devices["/dev/input/event20"]})
+	if c := controllers[dualSenseID]; c == nil || len(c.Devices) != 1 || c.Devices[0].Path != "/dev/input/event20" ||
+		c.Name() != "Microsoft X-Box 360 pad 0" {
+		t.Errorf("virtual device not grouped with the physical controller: %v", controllers)
+	}
+
+	// The only creator of virtual devices doesn't hold a physical controller
+	devices = newDevices()
+	delete(devices, "/dev/hidraw3")
+	delete(devices, "/dev/input/event10")
+	LinkVirtualDevices(devices, map[string][]*processes.Process{
+		"/dev/input/event20": {game},
+		UinputPath:           {remapper},
+	})
+	if d := devices["/dev/input/event20"]; d.Creator != nil || d.PhysicalID != "" {
+		t.Errorf("unsupported creator: got %v %q", d.Creator, d.PhysicalID)
+	}
+}
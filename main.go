@@ -23,14 +23,17 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/unrud/joystick-monitor/control"
 	"github.com/unrud/joystick-monitor/inotify"
 	"github.com/unrud/joystick-monitor/joystick"
 	"github.com/unrud/joystick-monitor/processes"
+	"github.com/unrud/joystick-monitor/reactor"
 	"github.com/unrud/joystick-monitor/screensaver"
+	"github.com/unrud/joystick-monitor/steam"
+	"io"
 	"log"
 	"os"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 )
@@ -55,86 +58,146 @@ func orFatal[T any](value T, err error) T {
 	return value
 }
 
-func keys[K comparable, V any](m map[K]V) (keys []K) {
-	for key := range m {
-		keys = append(keys, key)
+// findOpenJoysticks returns the joysticks that are opened by other processes
+// that are allowed by the rules. Holders that belong to Steam games are
+// attributed to the games.
+func findOpenJoysticks(scanner *processes.Scanner, rules *processes.ProcessRules, gameFinder *steam.GameFinder) map[string]*joystick.Device {
+	joysticks := orFatal(joystick.ListAllJoysticks())
+	files := map[string]struct{}{joystick.UinputPath: {}}
+	for path := range joysticks {
+		files[path] = struct{}{}
 	}
-	return keys
+	holders := orFatal(scanner.Scan(files))
+	joystick.LinkVirtualDevices(joysticks, holders)
+	games := gameFinder.FindGames(orFatal(scanner.FindByComm(steam.ReaperComm)))
+	openJoysticks := make(map[string]*joystick.Device)
+	for path, device := range joysticks {
+		if device.Holders = steam.Attribute(rules.Filter(holders[path]), games); len(device.Holders) > 0 {
+			openJoysticks[path] = device
+		}
+	}
+	return openJoysticks
 }
 
-type JoystickMonitorProxy struct {
+type fileID struct {
 	dev, ino uint64
-	monitor  *joystick.JoystickMonitor
-
-	closed     bool
-	closeMutex sync.Mutex
 }
 
-func TryNewJoystickMonitorProxy(path string, activity chan struct{}) *JoystickMonitorProxy {
-	file, err := os.Open(path)
+func statFileID(path string) (id fileID, found bool) {
+	stat, err := os.Stat(path)
 	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
-		return nil
+		return id, false
 	}
 	checkFatal(err)
-	stat, err := file.Stat()
-	if err != nil {
-		file.Close()
-		log.Fatal(err)
-	}
 	sysStat := stat.Sys().(*syscall.Stat_t)
-	proxy := &JoystickMonitorProxy{dev: sysStat.Dev, ino: sysStat.Ino}
-	if joystick.IsLegacyJoystickPath(path) {
-		proxy.monitor = joystick.NewLegacyJoystickMonitor(file)
-	} else {
-		proxy.monitor = joystick.NewEventJoystickMonitor(file)
-	}
-	go proxy.task(activity)
-	return proxy
+	return fileID{sysStat.Dev, sysStat.Ino}, true
 }
 
-func (proxy *JoystickMonitorProxy) task(activity chan struct{}) {
-	for {
-		select {
-		case <-proxy.monitor.C:
-			activity <- struct{}{}
-		case err := <-proxy.monitor.E:
-			if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.ENODEV) {
-				proxy.Close()
-				break
-			}
-			checkFatal(err)
+type ControllerMonitorProxy struct {
+	// Updated by rescans, the processes can change without reopening
+	controller *joystick.Controller
+	paths      []string
+	files      map[string]fileID
+	monitor    *joystick.ControllerMonitor
+
+	closed bool
+}
+
+func TryNewControllerMonitorProxy(controller *joystick.Controller, config *joystick.Config,
+	r *reactor.Reactor, queue *joystick.ActivityQueue) *ControllerMonitorProxy {
+	proxy := &ControllerMonitorProxy{controller: controller, paths: controller.Paths(), files: make(map[string]fileID)}
+	var monitors []*joystick.JoystickMonitor
+	for _, device := range controller.Devices {
+		if device.Class == joystick.ClassMotionSensor && !config.MotionEnabled(device) {
+			continue
+		}
+		file, err := os.OpenFile(device.Path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			continue
 		}
+		checkFatal(err)
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			log.Fatal(err)
+		}
+		sysStat := stat.Sys().(*syscall.Stat_t)
+		monitor, err := joystick.NewJoystickMonitor(file, device, config)
+		if err != nil {
+			file.Close()
+			log.Printf("%v: %v\n", device, err)
+			continue
+		}
+		monitors = append(monitors, monitor)
+		proxy.files[device.Path] = fileID{sysStat.Dev, sysStat.Ino}
+	}
+	if len(monitors) == 0 {
+		return nil
 	}
+	proxy.monitor = orFatal(joystick.NewControllerMonitor(controller, monitors, config, r, queue))
+	return proxy
 }
 
-func (proxy *JoystickMonitorProxy) IsSame(path string) bool {
-	proxy.closeMutex.Lock()
-	defer proxy.closeMutex.Unlock()
+// HasSameFile checks if the path is monitored and still refers to the same file
+func (proxy *ControllerMonitorProxy) HasSameFile(path string) bool {
 	if proxy.closed {
 		return false
 	}
-	stat, err := os.Stat(path)
-	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+	id, found := proxy.files[path]
+	if !found {
 		return false
 	}
-	checkFatal(err)
-	sysStat := stat.Sys().(*syscall.Stat_t)
-	return proxy.dev == sysStat.Dev && proxy.ino == sysStat.Ino
+	currentID, found := statFileID(path)
+	return found && id == currentID
 }
 
-func (proxy *JoystickMonitorProxy) Close() {
-	proxy.closeMutex.Lock()
-	defer proxy.closeMutex.Unlock()
-	proxy.closed = true
-	err := proxy.monitor.Close()
-	if errors.Is(err, os.ErrClosed) {
+// IsSame checks if the proxy monitors the current input nodes of the controller
+func (proxy *ControllerMonitorProxy) IsSame(controller *joystick.Controller) bool {
+	if strings.Join(proxy.paths, " ") != strings.Join(controller.Paths(), " ") {
+		return false
+	}
+	for path := range proxy.files {
+		if !proxy.HasSameFile(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDisconnected checks if the monitor failed because the device was removed.
+// Some drivers return EIO or end of file instead of ENODEV.
+func isDisconnected(err error) bool {
+	return errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.EIO) || errors.Is(err, io.EOF)
+}
+
+func (proxy *ControllerMonitorProxy) Close() {
+	if proxy.closed {
 		return
 	}
-	checkFatal(err)
+	proxy.closed = true
+	checkFatal(proxy.monitor.Close())
 }
 
 func main() {
-	var showVersion, dieWithParent bool
+	var showVersion, dieWithParent, inhibitSuspend bool
+	var backend string
+	var processRules processes.ProcessRules
+	joystickConfig := joystick.NewConfig()
+	flag.Var(&joystickConfig.AxisThreshold, "axis-threshold",
+		"fraction of the axis range that counts as activity, [DEVICE][/AXIS]=VALUE overrides it for devices and axes (repeatable)")
+	flag.Var(&joystickConfig.Deadzone, "deadzone",
+		"fraction of the axis range around the center that is ignored, [DEVICE][/AXIS]=VALUE overrides it for devices and axes (repeatable)")
+	flag.Var(&joystickConfig.MotionThreshold, "motion-threshold",
+		"angular velocity in °/s above which motion sensors count as activity (0 ignores motion sensors), [DEVICE][/AXIS]=VALUE overrides it for devices and axes (repeatable)")
+	flag.Var(&joystickConfig.PeriodicTolerance, "periodic-tolerance",
+		"maximal deviation in seconds between intervals of repeated button presses that are ignored as periodic (0 disables), [DEVICE][/BUTTON]=VALUE overrides it for devices and buttons (repeatable)")
+	flag.DurationVar(&joystickConfig.StuckTimeout, "stuck-timeout", joystickConfig.StuckTimeout,
+		"ignore controls that are the only source of activity for this long until other input arrives (0 disables)")
+	flag.Var(&processRules, "process-rule",
+		"allow|deny:FIELD=GLOB decides if processes count as users of joysticks by exe, comm, cmdline, unit or app, the last matching rule wins (repeatable)")
+	flag.StringVar(&backend, "backend", "auto", fmt.Sprintf("comma-separated list of inhibitor backends (auto, all, %v)",
+		strings.Join(screensaver.BackendNames(), ", ")))
+	flag.BoolVar(&inhibitSuspend, "inhibit-suspend", false, "also inhibit suspend if supported by the backend")
 	flag.BoolVar(&dieWithParent, "die-with-parent", false, "exit program when parent terminates")
 	flag.BoolVar(&showVersion, "version", false, "show program's version number and exit")
 	flag.Usage = func() {
@@ -150,84 +213,142 @@ func main() {
 	if dieWithParent {
 		checkFatal(processes.PrctlSetPdeathsig(syscall.SIGTERM))
 	}
+	// Steam libraries are only searched if the home directory is known
+	home, _ := os.UserHomeDir()
+	gameFinder := steam.NewGameFinder(home)
 	ignoreMarkerFile := orFatal(processes.CreateMarker(ignoreMarker))
 	defer ignoreMarkerFile.Close()
-	joystickMonitorProxies := make(map[string]*JoystickMonitorProxy)
+	processScanner := processes.NewScanner(ignoreMarker)
+	inputReactor := orFatal(reactor.New())
+	defer inputReactor.Close()
+	activityQueue := joystick.NewActivityQueue()
+	controllerMonitorProxies := make(map[string]*ControllerMonitorProxy)
 	defer func() {
-		for _, proxy := range joystickMonitorProxies {
+		for _, proxy := range controllerMonitorProxies {
 			proxy.Close()
 		}
 	}()
-	inputFileMonitor := orFatal(inotify.NewFileOpenCloseMonitor("/dev/input"))
+	inputFileMonitor := orFatal(inotify.NewFileOpenCloseMonitor("/dev/input", inputReactor))
 	defer inputFileMonitor.Close()
-	screensaver := orFatal(screensaver.NewScreensaver(appName, "user activity"))
+	hidrawFileMonitor := orFatal(inotify.NewPrefixFileOpenCloseMonitor("/dev", "hidraw", inputReactor))
+	defer hidrawFileMonitor.Close()
+	backends := orFatal(screensaver.ResolveBackends(strings.Split(backend, ",")))
+	log.Printf("backends [%v]\n", strings.Join(backends, " "))
+	screensaver := orFatal(screensaver.NewInhibitor(backends, appName, "user activity", inhibitSuspend))
 	defer screensaver.Close()
+	var controlService *control.Service
+	var controlCommands <-chan control.Command
+	if service, err := control.NewService(); err != nil {
+		log.Printf("D-Bus service: %v\n", err)
+	} else {
+		defer service.Close()
+		controlService = service
+		controlCommands = service.C
+	}
 	rescanTimer := time.NewTimer(0)
 	rescanTimerSet := true
-	uninhibitTimer := time.NewTimer(0)
-	if !uninhibitTimer.Stop() {
-		<-uninhibitTimer.C
-	}
-	uninhibitTimerSet := false
-	userActivity := make(chan struct{})
-	for {
-		select {
-		case event := <-inputFileMonitor.C:
+	inhibitController := NewInhibitController(screensaver, controlService, inhibitTimeout)
+	handleFileEvents := func(events []inotify.Event, err error) {
+		for _, event := range events {
 			if rescanTimerSet {
-				continue
+				break
 			}
 			switch event.Event {
 			case inotify.EventOpen:
-				if proxy, found := joystickMonitorProxies[event.Path]; found {
-					if proxy.IsSame(event.Path) {
-						continue
-					}
-				} else if !joystick.IsLegacyJoystickPath(event.Path) {
-					if _, found := orFatal(joystick.ListEventJoysticks())[event.Path]; !found {
-						continue
+				monitored := false
+				for _, proxy := range controllerMonitorProxies {
+					if proxy.HasSameFile(event.Path) {
+						monitored = true
+						break
 					}
 				}
+				if monitored || !orFatal(joystick.IsJoystick(event.Path)) {
+					continue
+				}
 			case inotify.EventClose:
-				if _, found := joystickMonitorProxies[event.Path]; !found {
+				monitored := false
+				for _, proxy := range controllerMonitorProxies {
+					if _, found := proxy.files[event.Path]; found {
+						monitored = true
+						break
+					}
+				}
+				if !monitored {
 					continue
 				}
 			}
 			rescanTimer.Reset(maxRescanInterval)
 			rescanTimerSet = true
-		case err := <-inputFileMonitor.E:
+		}
+		checkFatal(err)
+	}
+	for {
+		select {
+		case <-inputFileMonitor.C:
+			handleFileEvents(inputFileMonitor.Take())
+		case <-hidrawFileMonitor.C:
+			handleFileEvents(hidrawFileMonitor.Take())
+		case err := <-inputReactor.E:
 			checkFatal(err)
-		case <-userActivity:
-			if uninhibitTimerSet {
-				if !uninhibitTimer.Stop() {
-					<-uninhibitTimer.C
+		case <-activityQueue.C:
+			events, errs := activityQueue.Take()
+			for _, event := range events {
+				controller := event.Device.Controller
+				if proxy, found := controllerMonitorProxies[controller.ID]; found {
+					controller = proxy.controller
 				}
-			} else {
-				checkFatal(screensaver.Inhibit())
-				log.Println("inhibit")
+				var application string
+				if process := controller.Application(); process != nil {
+					application = process.Name()
+				}
+				inhibitController.Activity(controller.Name(), application)
+			}
+			for _, proxy := range controllerMonitorProxies {
+				if err, found := errs[proxy.monitor]; found {
+					if !isDisconnected(err) {
+						checkFatal(err)
+					}
+					proxy.Close()
+				}
+			}
+		case <-inhibitController.C:
+			inhibitController.Timeout()
+		case command := <-controlCommands:
+			switch command {
+			case control.CommandPause:
+				inhibitController.Pause()
+			case control.CommandResume:
+				inhibitController.Resume()
+			case control.CommandReportActivity:
+				inhibitController.Activity("", "")
 			}
-			uninhibitTimer.Reset(inhibitTimeout)
-			uninhibitTimerSet = true
-		case <-uninhibitTimer.C:
-			uninhibitTimerSet = false
-			checkFatal(screensaver.Uninhibit())
-			log.Println("uninhibit")
 		case <-rescanTimer.C:
 			rescanTimerSet = false
-			openJoystickPaths := orFatal(processes.FindOpenFiles(orFatal(joystick.ListAllJoysticks()), ignoreMarker))
-			for path, proxy := range joystickMonitorProxies {
-				if _, found := openJoystickPaths[path]; !found || !proxy.IsSame(path) {
+			controllers := joystick.GroupDevices(findOpenJoysticks(processScanner, &processRules, gameFinder))
+			for id, proxy := range controllerMonitorProxies {
+				if controller, found := controllers[id]; !found || !proxy.IsSame(controller) {
 					proxy.Close()
-					delete(joystickMonitorProxies, path)
+					delete(controllerMonitorProxies, id)
+				} else {
+					proxy.controller = controller
 				}
 			}
-			for path := range openJoystickPaths {
-				if _, found := joystickMonitorProxies[path]; !found {
-					if monitor := TryNewJoystickMonitorProxy(path, userActivity); monitor != nil {
-						joystickMonitorProxies[path] = monitor
+			for id, controller := range controllers {
+				if _, found := controllerMonitorProxies[id]; !found {
+					if monitor := TryNewControllerMonitorProxy(controller, joystickConfig, inputReactor, activityQueue); monitor != nil {
+						controllerMonitorProxies[id] = monitor
 					}
 				}
 			}
-			log.Printf("scan [%v]\n", strings.Join(keys(joystickMonitorProxies), " "))
+			var descriptions, names []string
+			for _, proxy := range controllerMonitorProxies {
+				descriptions = append(descriptions, proxy.controller.String())
+				names = append(names, proxy.controller.Name())
+			}
+			log.Printf("scan [%v]\n", strings.Join(descriptions, ", "))
+			if controlService != nil {
+				controlService.SetDevices(names)
+			}
 		}
 	}
 }
@@ -0,0 +1,44 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIsDisconnected(t *testing.T) {
+	for _, test := range []struct {
+		err          error
+		disconnected bool
+	}{
+		{&os.PathError{Op: "read", Path: "/dev/input/event3", Err: syscall.ENODEV}, true},
+		{&os.PathError{Op: "read", Path: "/dev/hidraw0", Err: syscall.EIO}, true},
+		{fmt.Errorf("read /dev/input/js0: %w", io.EOF), true},
+		{&os.PathError{Op: "read", Path: "/dev/input/event3", Err: syscall.EINVAL}, false},
+	} {
+		if disconnected := isDisconnected(test.err); disconnected != test.disconnected {
+			t.Errorf("%v: got %v, expected %v", test.err, disconnected, test.disconnected)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	SandboxFlatpak = "flatpak"
+	SandboxSnap    = "snap"
+)
+
+// parseFlatpakInfo returns the name in the Application group of the
+// .flatpak-info file in the root of Flatpak sandboxes
+func parseFlatpakInfo(info string) string {
+	group := ""
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = line[1 : len(line)-1]
+			continue
+		}
+		if key, value, found := strings.Cut(line, "="); found && group == "Application" && strings.TrimSpace(key) == "name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// unescapeUnitName reverses the escaping of systemd (e.g. \x2d for -)
+func unescapeUnitName(name string) string {
+	var unescaped strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && name[i+1] == 'x' {
+			if b, ok := parseHexByte(name[i+2 : i+4]); ok {
+				unescaped.WriteByte(b)
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(name[i])
+	}
+	return unescaped.String()
+}
+
+func parseHexByte(s string) (byte, bool) {
+	var b byte
+	for _, c := range []byte(s) {
+		switch {
+		case '0' <= c && c <= '9':
+			b = b<<4 | (c - '0')
+		case 'a' <= c && c <= 'f':
+			b = b<<4 | (c - 'a' + 10)
+		case 'A' <= c && c <= 'F':
+			b = b<<4 | (c - 'A' + 10)
+		default:
+			return 0, false
+		}
+	}
+	return b, true
+}
+
+// appIDFromCgroup identifies applications by the names of their scopes and
+// services: snap.NAME.APP[-UUID].scope of snaps and
+// app[-LAUNCHER]-APPID[-RANDOM].scope or app[-LAUNCHER]-APPID[@RANDOM].service
+// of desktop environments that follow the conventions of systemd
+func appIDFromCgroup(cgroup string) (appID, sandbox string) {
+	elements := strings.Split(cgroup, "/")
+	for i := len(elements) - 1; i >= 0; i-- {
+		unit := elements[i]
+		var name string
+		switch {
+		case strings.HasSuffix(unit, ".scope"):
+			name = strings.TrimSuffix(unit, ".scope")
+		case strings.HasSuffix(unit, ".service"):
+			name, _, _ = strings.Cut(strings.TrimSuffix(unit, ".service"), "@")
+		default:
+			continue
+		}
+		if strings.HasPrefix(name, "snap.") {
+			snapName, _, _ := strings.Cut(strings.TrimPrefix(name, "snap."), ".")
+			return snapName, SandboxSnap
+		}
+		if !strings.HasPrefix(name, "app-") {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(name, "app-"), "-")
+		if strings.HasSuffix(unit, ".scope") && len(parts) > 1 {
+			// Random suffix
+			parts = parts[:len(parts)-1]
+		}
+		// The application ID follows the optional launcher
+		return unescapeUnitName(parts[len(parts)-1]), ""
+	}
+	return "", ""
+}
+
+// readAppID identifies the application of the process in dir (/proc/PID)
+func readAppID(dir, cgroup string) (appID, sandbox string, err error) {
+	info, err := os.ReadFile(path.Join(dir, "root", ".flatpak-info"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+		return "", "", err
+	}
+	if appID := parseFlatpakInfo(string(info)); appID != "" {
+		return appID, SandboxFlatpak, nil
+	}
+	appID, sandbox = appIDFromCgroup(cgroup)
+	return appID, sandbox, nil
+}
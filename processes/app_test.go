@@ -0,0 +1,68 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"testing"
+)
+
+func TestParseFlatpakInfo(t *testing.T) {
+	info := "[Application]\nname=org.supertuxkart.SuperTuxKart\nruntime=runtime/org.freedesktop.Platform/x86_64/23.08\n\n[Instance]\nname=other\n"
+	if appID := parseFlatpakInfo(info); appID != "org.supertuxkart.SuperTuxKart" {
+		t.Errorf("got %q", appID)
+	}
+	if appID := parseFlatpakInfo("[Runtime]\nname=org.freedesktop.Platform\n"); appID != "" {
+		t.Errorf("runtime: got %q", appID)
+	}
+}
+
+func TestAppIDFromCgroup(t *testing.T) {
+	const userSlice = "/user.slice/user-1000.slice/user@1000.service/app.slice/"
+	for _, test := range []struct {
+		cgroup, appID, sandbox string
+	}{
+		{userSlice + "app-gnome-org.supertuxkart.SuperTuxKart-4242.scope", "org.supertuxkart.SuperTuxKart", ""},
+		{userSlice + "app-org.kde.konsole-a1b2c3.scope", "org.kde.konsole", ""},
+		{userSlice + "app-steam@autostart.service", "steam", ""},
+		{userSlice + "app-gnome-my\\x2dgame-1234.scope", "my-game", ""},
+		{userSlice + "snap.retroarch.retroarch-0f6b4c1e.scope", "retroarch", SandboxSnap},
+		{"/system.slice/snap.steam.steam.service", "steam", SandboxSnap},
+		{userSlice + "vte-spawn-0f6b4c1e.scope", "", ""},
+		{"/", "", ""},
+	} {
+		if appID, sandbox := appIDFromCgroup(test.cgroup); appID != test.appID || sandbox != test.sandbox {
+			t.Errorf("%v: got %q %q, expected %q %q", test.cgroup, appID, sandbox, test.appID, test.sandbox)
+		}
+	}
+}
+
+func TestSandboxedName(t *testing.T) {
+	p := &Process{Pid: 1234, Comm: "bwrap", AppID: "org.supertuxkart.SuperTuxKart", Sandbox: SandboxFlatpak}
+	if name := p.Name(); name != "SuperTuxKart" {
+		t.Errorf("got name %q", name)
+	}
+	if s := p.String(); s != "SuperTuxKart[1234 org.supertuxkart.SuperTuxKart]" {
+		t.Errorf("got %q", s)
+	}
+	p.Sandbox = ""
+	if name := p.Name(); name != "bwrap" {
+		t.Errorf("unsandboxed: got name %q", name)
+	}
+}
@@ -20,11 +20,7 @@
 package processes
 
 import (
-	"errors"
 	"os"
-	"path"
-	"strconv"
-	"strings"
 )
 
 func CreateMarker(name string) (*os.File, error) {
@@ -38,60 +34,3 @@ func CreateMarker(name string) (*os.File, error) {
 	}
 	return file, nil
 }
-
-func FindOpenFiles(files map[string]struct{}, ignoreMarkerName string) (openFiles map[string]struct{}, err error) {
-	procDir, err := os.Open("/proc")
-	if err != nil {
-		return nil, err
-	}
-	defer procDir.Close()
-	procEntries, err := procDir.ReadDir(0)
-	if err != nil {
-		return nil, err
-	}
-	openFiles = make(map[string]struct{})
-	if len(files) == 0 {
-		return
-	}
-	for _, procEntry := range procEntries {
-		pid, _ := strconv.Atoi(procEntry.Name())
-		if strconv.Itoa(pid) != procEntry.Name() {
-			continue
-		}
-		if err := func() error {
-			fdDir, err := os.Open(path.Join(procDir.Name(), procEntry.Name(), "fd"))
-			if err != nil {
-				return err
-			}
-			defer fdDir.Close()
-			fdEntries, err := fdDir.ReadDir(0)
-			if err != nil {
-				return err
-			}
-			var tempOpenFiles []string
-			for _, fdEntry := range fdEntries {
-				fdDest, err := os.Readlink(path.Join(fdDir.Name(), fdEntry.Name()))
-				if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
-					continue
-				}
-				if err != nil {
-					return err
-				}
-				if ignoreMarkerName != "" && strings.HasPrefix(path.Base(fdDest), ignoreMarkerName+".") {
-					tempOpenFiles = nil
-					break
-				}
-				if _, found := files[fdDest]; found {
-					tempOpenFiles = append(tempOpenFiles, fdDest)
-				}
-			}
-			for _, openFile := range tempOpenFiles {
-				openFiles[openFile] = struct{}{}
-			}
-			return nil
-		}(); err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
-			return nil, err
-		}
-	}
-	return
-}
@@ -0,0 +1,229 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	procDir = "/proc"
+	// The kernel truncates the name of processes
+	maxCommLen = 15
+)
+
+type Process struct {
+	Pid, PPid int
+	Comm, Exe string
+	Cmdline   []string
+	Uid       int
+	// Path in the cgroup hierarchy of systemd (e.g. /user.slice/.../app-steam@1.service)
+	Cgroup string
+	// Clock ticks after boot, identifies the process together with the pid
+	StartTime uint64
+	// ID of the application from Flatpak, snap or the systemd scope or
+	// service (e.g. org.supertuxkart.SuperTuxKart) and the sandbox of the
+	// process (SandboxFlatpak, SandboxSnap or empty)
+	AppID, Sandbox string
+	// Name of the application if it was identified otherwise (e.g. the
+	// title of a Steam game)
+	Application string
+}
+
+type procStat struct {
+	comm      string
+	ppid      int
+	startTime uint64
+}
+
+func readStat(procDir string, pid int) (procStat, error) {
+	statPath := path.Join(procDir, strconv.Itoa(pid), "stat")
+	data, err := os.ReadFile(statPath)
+	if err != nil {
+		return procStat{}, err
+	}
+	stat, err := parseStat(string(data))
+	if err != nil {
+		return procStat{}, fmt.Errorf("%v: %w", statPath, err)
+	}
+	return stat, nil
+}
+
+// ReadProcess reads the information of the process from /proc. Exe is empty
+// if the executable of the process can't be accessed.
+func ReadProcess(pid int) (*Process, error) {
+	stat, err := readStat(procDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	return readProcess(procDir, pid, stat)
+}
+
+func readProcess(procDir string, pid int, stat procStat) (*Process, error) {
+	dir := path.Join(procDir, strconv.Itoa(pid))
+	p := &Process{Pid: pid, Comm: stat.comm, PPid: stat.ppid, StartTime: stat.startTime}
+	status, err := os.ReadFile(path.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	if p.Uid, err = parseStatusUid(string(status)); err != nil {
+		return nil, fmt.Errorf("%v: %w", path.Join(dir, "status"), err)
+	}
+	cmdline, err := os.ReadFile(path.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	if len(cmdline) > 0 {
+		p.Cmdline = strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+	}
+	cgroup, err := os.ReadFile(path.Join(dir, "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	p.Cgroup = parseCgroup(string(cgroup))
+	if p.AppID, p.Sandbox, err = readAppID(dir, p.Cgroup); err != nil {
+		return nil, err
+	}
+	exe, err := os.Readlink(path.Join(dir, "exe"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+		return nil, err
+	}
+	p.Exe = strings.TrimSuffix(exe, " (deleted)")
+	return p, nil
+}
+
+func parseStat(data string) (stat procStat, err error) {
+	// The name can contain spaces and parentheses
+	start, end := strings.IndexByte(data, '('), strings.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return stat, errors.New("invalid format")
+	}
+	stat.comm = data[start+1 : end]
+	// Fields after the name start with the state (3)
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 20 {
+		return stat, errors.New("invalid format")
+	}
+	// ppid (4)
+	if stat.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return stat, err
+	}
+	// starttime (22)
+	if stat.startTime, err = strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return stat, err
+	}
+	return stat, nil
+}
+
+// IsDescendant checks if the process is a descendant of the ancestor
+func IsDescendant(p *Process, ancestor int) bool {
+	for pid := p.PPid; pid > 0; {
+		if pid == ancestor {
+			return true
+		}
+		stat, err := readStat(procDir, pid)
+		if err != nil {
+			return false
+		}
+		pid = stat.ppid
+	}
+	return false
+}
+
+func parseStatusUid(status string) (int, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if strings.HasPrefix(line, "Uid:") {
+			fields := strings.Fields(strings.TrimPrefix(line, "Uid:"))
+			if len(fields) == 0 {
+				break
+			}
+			// Real user ID
+			return strconv.Atoi(fields[0])
+		}
+	}
+	return 0, errors.New("Uid missing")
+}
+
+// parseCgroup returns the path in the unified hierarchy or in the hierarchy
+// of systemd with cgroup v1
+func parseCgroup(cgroup string) string {
+	var unifiedPath, systemdPath string
+	for _, line := range strings.Split(cgroup, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			unifiedPath = fields[2]
+		}
+		if fields[1] == "name=systemd" {
+			systemdPath = fields[2]
+		}
+	}
+	if unifiedPath == "" || unifiedPath == "/" && systemdPath != "" {
+		return systemdPath
+	}
+	return unifiedPath
+}
+
+// Unit returns the innermost systemd service or scope of the process
+func (p *Process) Unit() string {
+	elements := strings.Split(p.Cgroup, "/")
+	for i := len(elements) - 1; i >= 0; i-- {
+		if strings.HasSuffix(elements[i], ".service") || strings.HasSuffix(elements[i], ".scope") {
+			return elements[i]
+		}
+	}
+	return ""
+}
+
+// Name returns the name of the application. The last element of the ID of
+// sandboxed applications is used, because the executables of sandboxes are
+// often generic. Otherwise the untruncated name of the executable is used if
+// the name of the process was truncated.
+func (p *Process) Name() string {
+	if p.Application != "" {
+		return p.Application
+	}
+	if p.Sandbox != "" && p.AppID != "" {
+		return p.AppID[strings.LastIndexByte(p.AppID, '.')+1:]
+	}
+	if len(p.Comm) >= maxCommLen && len(p.Cmdline) > 0 {
+		if base := path.Base(p.Cmdline[0]); strings.HasPrefix(base, p.Comm) {
+			return base
+		}
+	}
+	if p.Comm == "" && p.Exe != "" {
+		return path.Base(p.Exe)
+	}
+	return p.Comm
+}
+
+func (p *Process) String() string {
+	if p.AppID != "" {
+		return fmt.Sprintf("%v[%d %v]", p.Name(), p.Pid, p.AppID)
+	}
+	return fmt.Sprintf("%v[%d]", p.Name(), p.Pid)
+}
@@ -0,0 +1,71 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	stat, err := parseStat("1234 (Game (x) 1) S 1 1234 1234 0 -1 4194560 100 0 0 0 5 2 0 0 20 0 4 0 98765 1000 100\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat != (procStat{comm: "Game (x) 1", ppid: 1, startTime: 98765}) {
+		t.Errorf("got %+v", stat)
+	}
+	if _, err := parseStat("1234 (game) S 1"); err == nil {
+		t.Error("truncated stat accepted")
+	}
+}
+
+func TestReadProcess(t *testing.T) {
+	p, err := ReadProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Pid != os.Getpid() || p.Uid != os.Getuid() || p.Comm == "" || p.StartTime == 0 ||
+		len(p.Cmdline) != len(os.Args) || p.Cmdline[0] != os.Args[0] {
+		t.Errorf("unexpected process %+v", p)
+	}
+	if p.PPid != os.Getppid() || !IsDescendant(p, os.Getppid()) || !IsDescendant(p, 1) || IsDescendant(p, p.Pid) {
+		t.Errorf("unexpected parents of %+v", p)
+	}
+	if _, err := ReadProcess(-1); !os.IsNotExist(err) {
+		t.Errorf("missing process: got %v", err)
+	}
+}
+
+func TestProcessName(t *testing.T) {
+	for _, test := range []struct {
+		process  Process
+		expected string
+	}{
+		{Process{Comm: "supertuxkart", Cmdline: []string{"/usr/bin/supertuxkart"}}, "supertuxkart"},
+		{Process{Comm: "retroarch-core-", Cmdline: []string{"/usr/bin/retroarch-core-launcher"}}, "retroarch-core-launcher"},
+		{Process{Comm: "Main Thread 123", Cmdline: []string{"/opt/game/game"}}, "Main Thread 123"},
+		{Process{Exe: "/usr/bin/game"}, "game"},
+	} {
+		if name := test.process.Name(); name != test.expected {
+			t.Errorf("%+v: got %q, expected %q", test.process, name, test.expected)
+		}
+	}
+}
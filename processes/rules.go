@@ -0,0 +1,121 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ruleFields = map[string]func(p *Process) string{
+	"exe":     func(p *Process) string { return p.Exe },
+	"comm":    func(p *Process) string { return p.Comm },
+	"cmdline": func(p *Process) string { return strings.Join(p.Cmdline, " ") },
+	"unit":    (*Process).Unit,
+	"app":     func(p *Process) string { return p.AppID },
+}
+
+type processRule struct {
+	allow   bool
+	field   string
+	glob    string
+	pattern *regexp.Regexp
+}
+
+// compileGlob converts the glob to a regular expression, * matches any
+// characters including / and ? matches a single character
+func compileGlob(glob string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// ProcessRules is a flag.Value with rules of the form allow|deny:FIELD=GLOB
+// that decide if processes count as users of devices. FIELD is exe, comm,
+// cmdline (arguments separated by spaces), unit (systemd service or scope) or
+// app (ID of the application, see Process.AppID).
+// The last matching rule takes precedence, processes without matching rule
+// are allowed.
+type ProcessRules struct {
+	rules []processRule
+}
+
+func (r *ProcessRules) String() string {
+	if r == nil {
+		return ""
+	}
+	var values []string
+	for _, rule := range r.rules {
+		action := "deny"
+		if rule.allow {
+			action = "allow"
+		}
+		values = append(values, fmt.Sprintf("%v:%v=%v", action, rule.field, rule.glob))
+	}
+	return strings.Join(values, " ")
+}
+
+func (r *ProcessRules) Set(value string) error {
+	action, match, found := strings.Cut(value, ":")
+	if !found || action != "allow" && action != "deny" {
+		return fmt.Errorf("invalid rule, expected allow|deny:FIELD=GLOB: %q", value)
+	}
+	field, glob, found := strings.Cut(match, "=")
+	if !found {
+		return fmt.Errorf("invalid rule, expected allow|deny:FIELD=GLOB: %q", value)
+	}
+	if _, found := ruleFields[field]; !found {
+		return fmt.Errorf("unknown field: %q", field)
+	}
+	r.rules = append(r.rules, processRule{action == "allow", field, glob, compileGlob(glob)})
+	return nil
+}
+
+func (r *ProcessRules) Allows(p *Process) bool {
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		rule := r.rules[i]
+		if rule.pattern.MatchString(ruleFields[rule.field](p)) {
+			return rule.allow
+		}
+	}
+	return true
+}
+
+// Filter returns the allowed processes
+func (r *ProcessRules) Filter(processes []*Process) (allowed []*Process) {
+	for _, p := range processes {
+		if r.Allows(p) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
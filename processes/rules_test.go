@@ -0,0 +1,73 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"testing"
+)
+
+func TestProcessRules(t *testing.T) {
+	var rules ProcessRules
+	for _, rule := range []string{
+		"deny:exe=/home/*/.local/share/Steam/*",
+		"deny:unit=app-steam@*.service",
+		"allow:cmdline=* -bigpicture*",
+		"deny:app=com.valvesoftware.Steam",
+	} {
+		if err := rules.Set(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, rule := range []string{"deny", "block:comm=steam", "deny:comm", "deny:pid=1"} {
+		if err := rules.Set(rule); err == nil {
+			t.Errorf("invalid rule %q accepted", rule)
+		}
+	}
+	for _, test := range []struct {
+		process  Process
+		expected bool
+	}{
+		{Process{Exe: "/home/user/.local/share/Steam/ubuntu12_32/steam", Cmdline: []string{"steam"}}, false},
+		{Process{Exe: "/home/user/.local/share/Steam/ubuntu12_32/steam", Cmdline: []string{"steam", "-bigpicture"}}, true},
+		{Process{Exe: "/usr/bin/steam-runtime", Cgroup: "/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam@autostart.service"}, false},
+		{Process{Exe: "/usr/bin/supertuxkart", Cgroup: "/user.slice/user-1000.slice/user@1000.service/app.slice/app-gnome-supertuxkart-1234.scope"}, true},
+		{Process{Exe: "/usr/bin/steam?"}, true},
+		{Process{Exe: "/app/bin/steam", AppID: "com.valvesoftware.Steam", Sandbox: SandboxFlatpak}, false},
+	} {
+		if allowed := rules.Allows(&test.process); allowed != test.expected {
+			t.Errorf("%+v: got %v, expected %v", test.process, allowed, test.expected)
+		}
+	}
+	if s := rules.String(); s != "deny:exe=/home/*/.local/share/Steam/* deny:unit=app-steam@*.service allow:cmdline=* -bigpicture* deny:app=com.valvesoftware.Steam" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	if cgroup := parseCgroup("0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam@autostart.service\n"); cgroup != "/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam@autostart.service" {
+		t.Errorf("unified: got %q", cgroup)
+	}
+	if cgroup := parseCgroup("1:name=systemd:/user.slice/steam.scope\n0::/\n"); cgroup != "/user.slice/steam.scope" {
+		t.Errorf("hybrid: got %q", cgroup)
+	}
+	if unit := (&Process{Cgroup: "/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam@autostart.service"}).Unit(); unit != "app-steam@autostart.service" {
+		t.Errorf("got unit %q", unit)
+	}
+}
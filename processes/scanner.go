@@ -0,0 +1,302 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"errors"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// Open files in this directory are cached in addition to the files of a
+	// scan, because the files of later scans (devices) are found there
+	cachedDir = "/dev/"
+	// Maximal number of processes whose file descriptors are all resolved
+	// again per scan
+	defaultRefreshLimit = 256
+)
+
+type scannedProcess struct {
+	stat procStat
+	// Open files by fd, empty if the file is not cached
+	fds     map[string]string
+	files   []string
+	ignored bool
+	// Read if the process has files of a scan open
+	process *Process
+	// Scan that resolved all file descriptors
+	generation uint64
+}
+
+func (p *scannedProcess) holds(files map[string]struct{}) bool {
+	for _, file := range p.files {
+		if _, found := files[file]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// Scanner finds the processes that have files open. The directory of file
+// descriptors of every process is read by each scan, but only new file
+// descriptors are resolved. The open files are cached by pid, start time and
+// fd. Because the numbers of closed file descriptors are reused, all file
+// descriptors of a limited number of processes that were resolved the longest
+// time ago are resolved again by each scan. Processes with the ignore marker
+// are skipped. Scanner must not be used concurrently.
+type Scanner struct {
+	procDir          string
+	ignoreMarkerName string
+	workers          int
+	refreshLimit     int
+
+	generation uint64
+	cache      map[int]*scannedProcess
+}
+
+func NewScanner(ignoreMarkerName string) *Scanner {
+	return newScanner(procDir, ignoreMarkerName)
+}
+
+func newScanner(procDir, ignoreMarkerName string) *Scanner {
+	return &Scanner{
+		procDir:          procDir,
+		ignoreMarkerName: ignoreMarkerName,
+		workers:          runtime.GOMAXPROCS(0),
+		refreshLimit:     defaultRefreshLimit,
+		cache:            make(map[int]*scannedProcess),
+	}
+}
+
+type scanJob struct {
+	pid     int
+	cached  *scannedProcess
+	refresh bool
+}
+
+type scanResult struct {
+	pid     int
+	scanned *scannedProcess
+	err     error
+}
+
+// Scan returns the processes that have the files open, sorted by their IDs
+func (s *Scanner) Scan(files map[string]struct{}) (map[string][]*Process, error) {
+	procEntries, err := os.ReadDir(s.procDir)
+	if err != nil {
+		return nil, err
+	}
+	s.generation++
+	var pids, cachedPids []int
+	for _, procEntry := range procEntries {
+		pid, _ := strconv.Atoi(procEntry.Name())
+		if strconv.Itoa(pid) != procEntry.Name() {
+			continue
+		}
+		pids = append(pids, pid)
+		if _, found := s.cache[pid]; found {
+			cachedPids = append(cachedPids, pid)
+		}
+	}
+	sort.Ints(pids)
+	sort.SliceStable(cachedPids, func(i, j int) bool {
+		return s.cache[cachedPids[i]].generation < s.cache[cachedPids[j]].generation
+	})
+	refresh := make(map[int]struct{})
+	for i := 0; i < len(cachedPids) && i < s.refreshLimit; i++ {
+		refresh[cachedPids[i]] = struct{}{}
+	}
+	jobs := make(chan scanJob)
+	results := make(chan scanResult)
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for job := range jobs {
+				scanned, err := s.scanProcess(job, files)
+				results <- scanResult{job.pid, scanned, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, pid := range pids {
+			_, isRefresh := refresh[pid]
+			jobs <- scanJob{pid, s.cache[pid], isRefresh}
+		}
+	}()
+	cache := make(map[int]*scannedProcess)
+	for range pids {
+		result := <-results
+		if result.err != nil && err == nil {
+			err = result.err
+		}
+		if result.scanned != nil {
+			cache[result.pid] = result.scanned
+		}
+	}
+	s.cache = cache
+	if err != nil {
+		return nil, err
+	}
+	openFiles := make(map[string][]*Process)
+	for _, pid := range pids {
+		scanned := cache[pid]
+		if scanned == nil || scanned.ignored {
+			continue
+		}
+		for _, file := range scanned.files {
+			if _, found := files[file]; found {
+				openFiles[file] = append(openFiles[file], scanned.process)
+			}
+		}
+	}
+	return openFiles, nil
+}
+
+// FindByComm returns the processes of the last scan with the name, sorted
+// by their IDs. Processes that exited since the scan are skipped.
+func (s *Scanner) FindByComm(comm string) ([]*Process, error) {
+	var pids []int
+	for pid, scanned := range s.cache {
+		if scanned.stat.comm == comm && !scanned.ignored {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	var found []*Process
+	for _, pid := range pids {
+		scanned := s.cache[pid]
+		if scanned.process == nil {
+			p, err := readProcess(s.procDir, pid, scanned.stat)
+			if err != nil {
+				if err = ignoreGone(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			scanned.process = p
+		}
+		found = append(found, scanned.process)
+	}
+	return found, nil
+}
+
+// scanProcess returns nil if the process disappeared or can't be accessed
+func (s *Scanner) scanProcess(job scanJob, files map[string]struct{}) (*scannedProcess, error) {
+	stat, err := readStat(s.procDir, job.pid)
+	if err != nil {
+		return nil, ignoreGone(err)
+	}
+	cached := job.cached
+	if cached != nil && (cached.stat.startTime != stat.startTime || cached.stat.comm != stat.comm) {
+		// New process with the same pid or replaced by exec
+		cached = nil
+	}
+	scanned := &scannedProcess{stat: stat, generation: s.generation}
+	if cached != nil {
+		scanned.process = cached.process
+		if job.refresh {
+			cached = nil
+		} else {
+			scanned.generation = cached.generation
+		}
+	}
+	// The open files of processes of other users can't be accessed
+	if err := s.readOpenFiles(job.pid, cached, scanned, files); err != nil && !errors.Is(err, os.ErrPermission) {
+		return nil, ignoreGone(err)
+	}
+	if scanned.process == nil && !scanned.ignored && scanned.holds(files) {
+		if scanned.process, err = readProcess(s.procDir, job.pid, stat); err != nil {
+			return nil, ignoreGone(err)
+		}
+	}
+	return scanned, nil
+}
+
+func ignoreGone(err error) error {
+	// ESRCH is returned for processes that exit while they are read
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// readOpenFiles reads the open files of the process into scanned, only the
+// file descriptors that are missing in cached are resolved
+func (s *Scanner) readOpenFiles(pid int, cached, scanned *scannedProcess, files map[string]struct{}) error {
+	fdDir, err := os.Open(path.Join(s.procDir, strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return err
+	}
+	defer fdDir.Close()
+	fdNames, err := fdDir.Readdirnames(0)
+	if err != nil {
+		return err
+	}
+	scanned.fds = make(map[string]string, len(fdNames))
+	seen := make(map[string]struct{})
+	for _, fdName := range fdNames {
+		file, found := "", false
+		if cached != nil {
+			file, found = cached.fds[fdName]
+		}
+		if !found {
+			file, err = s.readFd(path.Join(fdDir.Name(), fdName), files)
+			if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+				// Closed while reading
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		scanned.fds[fdName] = file
+		if file == "" {
+			continue
+		}
+		if s.ignoreMarkerName != "" && strings.HasPrefix(path.Base(file), s.ignoreMarkerName+".") {
+			scanned.ignored = true
+		}
+		if _, found := seen[file]; !found {
+			seen[file] = struct{}{}
+			scanned.files = append(scanned.files, file)
+		}
+	}
+	return nil
+}
+
+// readFd returns the open file of the file descriptor if it's cached
+func (s *Scanner) readFd(fdPath string, files map[string]struct{}) (string, error) {
+	file, err := os.Readlink(fdPath)
+	if err != nil {
+		return "", err
+	}
+	_, found := files[file]
+	if found || strings.HasPrefix(file, cachedDir) ||
+		s.ignoreMarkerName != "" && strings.HasPrefix(path.Base(file), s.ignoreMarkerName+".") {
+		return file, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,263 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package processes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type fakeProcess struct {
+	pid       int
+	comm      string
+	startTime uint64
+	// Open files by fd, closed if empty
+	fds []string
+}
+
+// writeFakeProcess creates the files of the process in the synthetic proc tree
+func writeFakeProcess(tb testing.TB, procDir string, p fakeProcess) {
+	tb.Helper()
+	dir := filepath.Join(procDir, strconv.Itoa(p.pid))
+	if err := os.RemoveAll(dir); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o755); err != nil {
+		tb.Fatal(err)
+	}
+	files := map[string]string{
+		"stat": fmt.Sprintf("%d (%v) S 1 %d %d 0 -1 4194560 100 0 0 0 10 0 0 0 20 0 1 0 %d 1000 100\n",
+			p.pid, p.comm, p.pid, p.pid, p.startTime),
+		"status":  "Name:\t" + p.comm + "\nUid:\t1000\t1000\t1000\t1000\n",
+		"cmdline": "/usr/bin/" + p.comm + "\x00",
+		"cgroup":  "0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-" + p.comm + "-1.scope\n",
+	}
+	for fd, file := range p.fds {
+		if file == "" {
+			continue
+		}
+		if err := os.Symlink(file, filepath.Join(dir, "fd", strconv.Itoa(fd))); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func holderPids(openFiles map[string][]*Process) map[string][]int {
+	pids := make(map[string][]int)
+	for file, holders := range openFiles {
+		for _, p := range holders {
+			pids[file] = append(pids[file], p.Pid)
+		}
+	}
+	return pids
+}
+
+func TestScanner(t *testing.T) {
+	procDir := t.TempDir()
+	writeFakeProcess(t, procDir, fakeProcess{1, "game", 100, []string{"/dev/null", "/dev/input/event1"}})
+	writeFakeProcess(t, procDir, fakeProcess{2, "monitor", 100, []string{"/dev/input/event1", "/tmp/ignore-test.abc (deleted)"}})
+	writeFakeProcess(t, procDir, fakeProcess{3, "steam", 100, []string{"/tmp/a", "/dev/input/event2", "/dev/input/event1"}})
+	s := newScanner(procDir, "ignore-test")
+	s.refreshLimit = 0
+	files := map[string]struct{}{"/dev/input/event1": {}, "/dev/input/event2": {}}
+	scan := func(expected map[string][]int) {
+		t.Helper()
+		openFiles, err := s.Scan(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pids := holderPids(openFiles); !reflect.DeepEqual(pids, expected) {
+			t.Errorf("got %v, expected %v", pids, expected)
+		}
+	}
+	scan(map[string][]int{"/dev/input/event1": {1, 3}, "/dev/input/event2": {3}})
+	openFiles, _ := s.Scan(files)
+	if p := openFiles["/dev/input/event2"][0]; p.Comm != "steam" || p.Uid != 1000 || p.AppID != "steam" {
+		t.Errorf("unexpected process %+v", p)
+	}
+
+	// Closed and new file descriptors
+	writeFakeProcess(t, procDir, fakeProcess{3, "steam", 100, []string{"/tmp/a", "", "/dev/input/event1", "/dev/input/event2"}})
+	// The cached open files in /dev are used for files of later scans
+	files["/dev/null"] = struct{}{}
+	scan(map[string][]int{"/dev/input/event1": {1, 3}, "/dev/input/event2": {3}, "/dev/null": {1}})
+	delete(files, "/dev/null")
+
+	// Reused file descriptors are only resolved again by refreshes
+	writeFakeProcess(t, procDir, fakeProcess{3, "steam", 100, []string{"/dev/input/event2", "", "/dev/input/event1", "/tmp/b"}})
+	scan(map[string][]int{"/dev/input/event1": {1, 3}, "/dev/input/event2": {3}})
+	s.refreshLimit = 1
+	// Process 1 was resolved the longest time ago
+	scan(map[string][]int{"/dev/input/event1": {1, 3}, "/dev/input/event2": {3}})
+	scan(map[string][]int{"/dev/input/event1": {1, 3}, "/dev/input/event2": {3}})
+	scan(map[string][]int{"/dev/input/event1": {1, 3}, "/dev/input/event2": {3}})
+	if s.cache[3].fds["0"] != "/dev/input/event2" || s.cache[3].fds["3"] != "" {
+		t.Errorf("reused file descriptors not refreshed: %v", s.cache[3].fds)
+	}
+	s.refreshLimit = 0
+
+	// Replaced process with the same pid
+	writeFakeProcess(t, procDir, fakeProcess{1, "game", 200, []string{"/dev/input/event2"}})
+	// Executed other program
+	writeFakeProcess(t, procDir, fakeProcess{3, "game", 100, nil})
+	scan(map[string][]int{"/dev/input/event2": {1}})
+
+	if err := os.RemoveAll(filepath.Join(procDir, "1")); err != nil {
+		t.Fatal(err)
+	}
+	scan(map[string][]int{})
+	if _, found := s.cache[1]; found {
+		t.Error("exited process is still cached")
+	}
+}
+
+func TestScannerFindByComm(t *testing.T) {
+	procDir := t.TempDir()
+	writeFakeProcess(t, procDir, fakeProcess{1, "steam", 100, []string{"/dev/input/event1"}})
+	// Holds no devices
+	writeFakeProcess(t, procDir, fakeProcess{2, "reaper", 100, nil})
+	writeFakeProcess(t, procDir, fakeProcess{3, "reaper", 100, []string{"/tmp/ignore-test.abc"}})
+	writeFakeProcess(t, procDir, fakeProcess{4, "reaper", 100, nil})
+	s := newScanner(procDir, "ignore-test")
+	if _, err := s.Scan(map[string]struct{}{"/dev/input/event1": {}}); err != nil {
+		t.Fatal(err)
+	}
+	// Exited after the scan
+	if err := os.RemoveAll(filepath.Join(procDir, "4")); err != nil {
+		t.Fatal(err)
+	}
+	found, err := s.FindByComm("reaper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Pid != 2 || found[0].Cmdline[0] != "/usr/bin/reaper" {
+		t.Errorf("got %v", found)
+	}
+}
+
+// readlinkAll resolves all file descriptors of all processes without cache
+func readlinkAll(procDir string, files map[string]struct{}) (map[string][]int, error) {
+	procEntries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	openFiles := make(map[string][]int)
+	for _, procEntry := range procEntries {
+		pid, err := strconv.Atoi(procEntry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(procDir, procEntry.Name(), "fd")
+		fdEntries, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fdEntry := range fdEntries {
+			file, err := os.Readlink(filepath.Join(fdDir, fdEntry.Name()))
+			if err != nil {
+				continue
+			}
+			if _, found := files[file]; found {
+				openFiles[file] = append(openFiles[file], pid)
+			}
+		}
+	}
+	return openFiles, nil
+}
+
+// BenchmarkScanner compares the scanner with resolving all file descriptors
+// in a synthetic proc tree and in /proc
+func BenchmarkScanner(b *testing.B) {
+	const (
+		processCount = 1000
+		fdCount      = 64
+	)
+	syntheticDir := b.TempDir()
+	files := make(map[string]struct{})
+	for pid := 1; pid <= processCount; pid++ {
+		fds := make([]string, fdCount)
+		for fd := range fds {
+			fds[fd] = fmt.Sprintf("/tmp/file%d", fd)
+		}
+		if pid%50 == 0 {
+			fds[fdCount/2] = fmt.Sprintf("/dev/input/event%d", pid%8)
+		}
+		writeFakeProcess(b, syntheticDir, fakeProcess{pid, "process", 100, fds})
+	}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("/dev/input/event%d", i)] = struct{}{}
+	}
+	for _, procDir := range []struct {
+		name, dir string
+	}{
+		{"synthetic", syntheticDir},
+		{"proc", procDir},
+	} {
+		b.Run(procDir.name+"/readlink-only", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := readlinkAll(procDir.dir, files); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		for _, test := range []struct {
+			name        string
+			workers     int
+			incremental bool
+		}{
+			{"full-sequential", 1, false},
+			{"full-parallel", 0, false},
+			{"incremental-sequential", 1, true},
+			{"incremental-parallel", 0, true},
+		} {
+			b.Run(procDir.name+"/"+test.name, func(b *testing.B) {
+				newTestScanner := func() *Scanner {
+					s := newScanner(procDir.dir, "")
+					if test.workers > 0 {
+						s.workers = test.workers
+					}
+					return s
+				}
+				s := newTestScanner()
+				if _, err := s.Scan(files); err != nil {
+					b.Fatal(err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if !test.incremental {
+						s = newTestScanner()
+					}
+					if _, err := s.Scan(files); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
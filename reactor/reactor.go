@@ -0,0 +1,188 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package reactor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const maxEvents = 64
+
+// Handler is called when the file is readable, the file is removed from the
+// reactor if it returns false
+type Handler func() bool
+
+// Reactor waits for readable files with epoll and calls their handlers from a
+// single goroutine. Handlers must not call Add or Remove.
+type Reactor struct {
+	epollFd       int
+	wakeR, wakeW  int
+	handlers      map[int32]Handler
+	handlersMutex sync.Mutex
+	closed        bool
+	done          chan struct{}
+
+	e chan error
+	E <-chan error
+}
+
+func New() (*Reactor, error) {
+	epollFd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("EpollCreate1: %w", err)
+	}
+	var wake [2]int
+	if err := syscall.Pipe2(wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		syscall.Close(epollFd)
+		return nil, fmt.Errorf("Pipe2: %w", err)
+	}
+	chanE := make(chan error, 1)
+	r := &Reactor{
+		epollFd:  epollFd,
+		wakeR:    wake[0],
+		wakeW:    wake[1],
+		handlers: make(map[int32]Handler),
+		done:     make(chan struct{}),
+		e:        chanE,
+		E:        chanE,
+	}
+	if err := r.ctl(syscall.EPOLL_CTL_ADD, r.wakeR); err != nil {
+		r.closeFds()
+		return nil, err
+	}
+	go r.task()
+	return r, nil
+}
+
+func (r *Reactor) ctl(op, fd int) error {
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+	if err := syscall.EpollCtl(r.epollFd, op, fd, &event); err != nil {
+		return fmt.Errorf("EpollCtl %d: %w", fd, err)
+	}
+	return nil
+}
+
+func (r *Reactor) closeFds() {
+	syscall.Close(r.epollFd)
+	syscall.Close(r.wakeR)
+	syscall.Close(r.wakeW)
+}
+
+func fileFd(file *os.File) (fd int, err error) {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	if err := conn.Control(func(rawFd uintptr) { fd = int(rawFd) }); err != nil {
+		return -1, err
+	}
+	return fd, nil
+}
+
+func (r *Reactor) Add(file *os.File, handler Handler) error {
+	fd, err := fileFd(file)
+	if err != nil {
+		return err
+	}
+	r.handlersMutex.Lock()
+	defer r.handlersMutex.Unlock()
+	if err := r.ctl(syscall.EPOLL_CTL_ADD, fd); err != nil {
+		return err
+	}
+	r.handlers[int32(fd)] = handler
+	return nil
+}
+
+// Remove stops calling the handler of the file. The handler is not running
+// when Remove returns and the file can be closed.
+func (r *Reactor) Remove(file *os.File) error {
+	fd, err := fileFd(file)
+	if err != nil {
+		return err
+	}
+	r.handlersMutex.Lock()
+	defer r.handlersMutex.Unlock()
+	if _, found := r.handlers[int32(fd)]; !found {
+		return nil
+	}
+	delete(r.handlers, int32(fd))
+	return r.ctl(syscall.EPOLL_CTL_DEL, fd)
+}
+
+func (r *Reactor) task() {
+	defer close(r.done)
+	var events [maxEvents]syscall.EpollEvent
+	for {
+		n, err := syscall.EpollWait(r.epollFd, events[:], -1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			r.e <- fmt.Errorf("EpollWait: %w", err)
+			return
+		}
+		r.handlersMutex.Lock()
+		if r.closed {
+			r.handlersMutex.Unlock()
+			return
+		}
+		for _, event := range events[:n] {
+			// Handlers of removed files are missing
+			if handler, found := r.handlers[event.Fd]; found && !handler() {
+				delete(r.handlers, event.Fd)
+				r.ctl(syscall.EPOLL_CTL_DEL, int(event.Fd))
+			}
+		}
+		r.handlersMutex.Unlock()
+	}
+}
+
+func (r *Reactor) Close() error {
+	r.handlersMutex.Lock()
+	r.closed = true
+	r.handlersMutex.Unlock()
+	syscall.Write(r.wakeW, []byte{0})
+	<-r.done
+	r.closeFds()
+	return nil
+}
+
+// Read reads from the file without blocking, it returns syscall.EAGAIN if
+// no data is available
+func Read(file *os.File, buf []byte) (n int, err error) {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	if err := conn.Read(func(fd uintptr) bool {
+		n, err = syscall.Read(int(fd), buf)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: file.Name(), Err: err}
+	}
+	return n, nil
+}
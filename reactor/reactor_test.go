@@ -0,0 +1,133 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package reactor
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testTimeout = 50 * time.Millisecond
+
+func newTestPipe(t *testing.T) (*os.File, *os.File) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+	return r, w
+}
+
+func TestReactor(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	pipeR, pipeW := newTestPipe(t)
+	data := make(chan string, 10)
+	if err := r.Add(pipeR, func() bool {
+		var buf [16]byte
+		n, err := Read(pipeR, buf[:])
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+		data <- string(buf[:n])
+		return string(buf[:n]) != "stop"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectData := func(expected string) {
+		t.Helper()
+		select {
+		case value := <-data:
+			if value != expected {
+				t.Errorf("got %q, expected %q", value, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler not called for %q", expected)
+		}
+	}
+	expectNoData := func() {
+		t.Helper()
+		select {
+		case value := <-data:
+			t.Errorf("unexpected call with %q", value)
+		case <-time.After(testTimeout):
+		}
+	}
+	pipeW.Write([]byte("a"))
+	expectData("a")
+	pipeW.Write([]byte("stop"))
+	expectData("stop")
+	pipeW.Write([]byte("b"))
+	expectNoData()
+}
+
+func TestReactorRemove(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	pipeR, pipeW := newTestPipe(t)
+	called := make(chan struct{}, 10)
+	if err := r.Add(pipeR, func() bool {
+		var buf [16]byte
+		Read(pipeR, buf[:])
+		called <- struct{}{}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pipeW.Write([]byte("a"))
+	<-called
+	if err := r.Remove(pipeR); err != nil {
+		t.Fatal(err)
+	}
+	pipeW.Write([]byte("b"))
+	select {
+	case <-called:
+		t.Error("handler called after Remove")
+	case <-time.After(testTimeout):
+	}
+	if err := r.Remove(pipeR); err != nil {
+		t.Errorf("second Remove: %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	pipeR, pipeW := newTestPipe(t)
+	var buf [16]byte
+	if _, err := Read(pipeR, buf[:]); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("got %v, expected EAGAIN", err)
+	}
+	pipeW.Write([]byte("abc"))
+	if n, err := Read(pipeR, buf[:]); err != nil || string(buf[:n]) != "abc" {
+		t.Errorf("got %q, %v", buf[:n], err)
+	}
+}
@@ -20,69 +20,55 @@
 package screensaver
 
 import (
-	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
 )
 
+const screenSaverDest = "org.freedesktop.ScreenSaver"
+
 type Screensaver struct {
-	bus          *dbus.Conn
-	screenSaver  dbus.BusObject
-	name, reason string
+	serviceInhibitor
+	name string
 
 	cookie uint32
 }
 
 func NewScreensaver(name, reason string) (*Screensaver, error) {
-	bus, err := dbus.SessionBusPrivate()
-	if err != nil {
-		return nil, err
-	}
-	err = bus.Auth(nil)
-	if err != nil {
-		bus.Close()
-		return nil, err
-	}
-	err = bus.Hello()
-	if err != nil {
-		bus.Close()
+	s := &Screensaver{name: name}
+	if err := s.start(connectSessionBus, screenSaverDest, reason, s); err != nil {
 		return nil, err
 	}
-	return &Screensaver{
-		bus: bus,
-		screenSaver: bus.Object("org.freedesktop.ScreenSaver",
-			"/org/freedesktop/ScreenSaver"),
-		name:   name,
-		reason: reason,
-	}, nil
+	return s, nil
 }
 
-func (s *Screensaver) Inhibit() error {
-	if s.cookie != 0 {
-		return errors.New("Screensaver already inhibited")
-	}
+func (s *Screensaver) object(bus *dbus.Conn) dbus.BusObject {
+	return bus.Object(screenSaverDest, "/org/freedesktop/ScreenSaver")
+}
+
+func (s *Screensaver) inhibit(bus *dbus.Conn, reason string) error {
 	var cookie uint32
-	if err := s.screenSaver.Call("org.freedesktop.ScreenSaver.Inhibit", 0, s.name, s.reason).Store(&cookie); err != nil {
+	if err := s.object(bus).Call("org.freedesktop.ScreenSaver.Inhibit", 0, s.name, reason).Store(&cookie); err != nil {
 		return err
 	}
 	if cookie == 0 {
-		return fmt.Errorf("invalid cookie (%d) received", s.cookie)
+		return fmt.Errorf("invalid cookie (%d) received", cookie)
 	}
 	s.cookie = cookie
 	return nil
 }
 
-func (s *Screensaver) Uninhibit() error {
+func (s *Screensaver) uninhibit(bus *dbus.Conn) error {
 	if s.cookie == 0 {
-		return errors.New("Screensaver not inhibited")
+		return nil
 	}
-	if err := s.screenSaver.Call("org.freedesktop.ScreenSaver.UnInhibit", 0, s.cookie).Store(); err != nil {
+	if err := s.object(bus).Call("org.freedesktop.ScreenSaver.UnInhibit", 0, s.cookie).Store(); err != nil {
 		return err
 	}
 	s.cookie = 0
 	return nil
 }
 
-func (s *Screensaver) Close() error {
-	return s.bus.Close()
+func (s *Screensaver) reset() bool {
+	s.cookie = 0
+	return true
 }
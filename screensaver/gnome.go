@@ -0,0 +1,83 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	gnomeSessionManagerDest = "org.gnome.SessionManager"
+	gnomeInhibitSuspend     = 4
+	gnomeInhibitIdle        = 8
+)
+
+type GnomeSessionManager struct {
+	serviceInhibitor
+	name  string
+	flags uint32
+
+	cookie uint32
+}
+
+func NewGnomeSessionManager(name, reason string, suspend bool) (*GnomeSessionManager, error) {
+	var flags uint32 = gnomeInhibitIdle
+	if suspend {
+		flags |= gnomeInhibitSuspend
+	}
+	s := &GnomeSessionManager{name: name, flags: flags}
+	if err := s.start(connectSessionBus, gnomeSessionManagerDest, reason, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *GnomeSessionManager) object(bus *dbus.Conn) dbus.BusObject {
+	return bus.Object(gnomeSessionManagerDest, "/org/gnome/SessionManager")
+}
+
+func (s *GnomeSessionManager) inhibit(bus *dbus.Conn, reason string) error {
+	var cookie uint32
+	if err := s.object(bus).Call("org.gnome.SessionManager.Inhibit", 0, s.name, uint32(0), reason, s.flags).Store(&cookie); err != nil {
+		return err
+	}
+	if cookie == 0 {
+		return fmt.Errorf("invalid cookie (%d) received", cookie)
+	}
+	s.cookie = cookie
+	return nil
+}
+
+func (s *GnomeSessionManager) uninhibit(bus *dbus.Conn) error {
+	if s.cookie == 0 {
+		return nil
+	}
+	if err := s.object(bus).Call("org.gnome.SessionManager.Uninhibit", 0, s.cookie).Store(); err != nil {
+		return err
+	}
+	s.cookie = 0
+	return nil
+}
+
+func (s *GnomeSessionManager) reset() bool {
+	s.cookie = 0
+	return true
+}
@@ -0,0 +1,216 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+)
+
+type Inhibitor interface {
+	// Inhibit uses the reason given to the constructor if reason is empty
+	Inhibit(reason string) error
+	Uninhibit() error
+	Close() error
+}
+
+type backend struct {
+	name    string
+	service string
+	system  bool
+	new     func(name, reason string, suspend bool) (Inhibitor, error)
+}
+
+// Sorted by preference
+var backends = []backend{
+	{"gnome", gnomeSessionManagerDest, false, func(name, reason string, suspend bool) (Inhibitor, error) {
+		return asInhibitor(NewGnomeSessionManager(name, reason, suspend))
+	}},
+	{"kde", kdePowerManagementDest, false, func(name, reason string, suspend bool) (Inhibitor, error) {
+		return asInhibitor(NewKdePowerManagement(name, reason, suspend))
+	}},
+	{"freedesktop", screenSaverDest, false, func(name, reason string, suspend bool) (Inhibitor, error) {
+		return asInhibitor(NewScreensaver(name, reason))
+	}},
+	{"portal", portalDest, false, func(name, reason string, suspend bool) (Inhibitor, error) {
+		return asInhibitor(NewPortal(reason, suspend))
+	}},
+	{"logind", logindDest, true, func(name, reason string, suspend bool) (Inhibitor, error) {
+		return asInhibitor(NewLogind(name, reason, suspend))
+	}},
+}
+
+func asInhibitor[T Inhibitor](inhibitor T, err error) (Inhibitor, error) {
+	if err != nil {
+		return nil, err
+	}
+	return inhibitor, nil
+}
+
+func findBackend(name string) *backend {
+	for i := range backends {
+		if backends[i].name == name {
+			return &backends[i]
+		}
+	}
+	return nil
+}
+
+func BackendNames() (names []string) {
+	for _, backend := range backends {
+		names = append(names, backend.name)
+	}
+	return names
+}
+
+func DetectBackends() ([]string, error) {
+	var sessionNames, systemNames map[string]struct{}
+	for _, bus := range []struct {
+		connect func() (*dbus.Conn, error)
+		names   *map[string]struct{}
+	}{
+		{connectSessionBus, &sessionNames},
+		{connectSystemBus, &systemNames},
+	} {
+		conn, err := bus.connect()
+		if err != nil {
+			continue
+		}
+		names, err := listBusNames(conn)
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+		*bus.names = names
+	}
+	var detected []string
+	for _, backend := range backends {
+		names := sessionNames
+		if backend.system {
+			names = systemNames
+		}
+		if _, found := names[backend.service]; found {
+			detected = append(detected, backend.name)
+		}
+	}
+	return detected, nil
+}
+
+func listBusNames(bus *dbus.Conn) (map[string]struct{}, error) {
+	names := make(map[string]struct{})
+	for _, method := range []string{"org.freedesktop.DBus.ListNames", "org.freedesktop.DBus.ListActivatableNames"} {
+		var tempNames []string
+		if err := bus.BusObject().Call(method, 0).Store(&tempNames); err != nil {
+			return nil, err
+		}
+		for _, name := range tempNames {
+			names[name] = struct{}{}
+		}
+	}
+	return names, nil
+}
+
+// ResolveBackends replaces "auto" with the best available backend and "all"
+// with every available backend.
+func ResolveBackends(names []string) (resolved []string, err error) {
+	var detected []string
+	seen := make(map[string]struct{})
+	for _, name := range names {
+		var tempNames []string
+		switch name {
+		case "auto", "all":
+			if detected == nil {
+				if detected, err = DetectBackends(); err != nil {
+					return nil, err
+				}
+			}
+			if len(detected) == 0 {
+				return nil, errors.New("no inhibitor backend available")
+			}
+			tempNames = detected
+			if name == "auto" {
+				tempNames = detected[:1]
+			}
+		default:
+			if findBackend(name) == nil {
+				return nil, fmt.Errorf("unknown inhibitor backend: %q", name)
+			}
+			tempNames = []string{name}
+		}
+		for _, name := range tempNames {
+			if _, found := seen[name]; !found {
+				seen[name] = struct{}{}
+				resolved = append(resolved, name)
+			}
+		}
+	}
+	if len(resolved) == 0 {
+		return nil, errors.New("no inhibitor backend selected")
+	}
+	return resolved, nil
+}
+
+func NewInhibitor(backendNames []string, name, reason string, suspend bool) (Inhibitor, error) {
+	var inhibitors MultiInhibitor
+	for _, backendName := range backendNames {
+		backend := findBackend(backendName)
+		if backend == nil {
+			inhibitors.Close()
+			return nil, fmt.Errorf("unknown inhibitor backend: %q", backendName)
+		}
+		inhibitor, err := backend.new(name, reason, suspend)
+		if err != nil {
+			inhibitors.Close()
+			return nil, fmt.Errorf("inhibitor backend %v: %w", backendName, err)
+		}
+		inhibitors = append(inhibitors, inhibitor)
+	}
+	if len(inhibitors) == 1 {
+		return inhibitors[0], nil
+	}
+	return inhibitors, nil
+}
+
+func connectSessionBus() (*dbus.Conn, error) {
+	return connectBus(dbus.SessionBusPrivate)
+}
+
+func connectSystemBus() (*dbus.Conn, error) {
+	return connectBus(dbus.SystemBusPrivate)
+}
+
+func connectBus(open func(...dbus.ConnOption) (*dbus.Conn, error)) (*dbus.Conn, error) {
+	bus, err := open()
+	if err != nil {
+		return nil, err
+	}
+	err = bus.Auth(nil)
+	if err != nil {
+		bus.Close()
+		return nil, err
+	}
+	err = bus.Hello()
+	if err != nil {
+		bus.Close()
+		return nil, err
+	}
+	return bus, nil
+}
@@ -0,0 +1,336 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver_test
+
+import (
+	"github.com/godbus/dbus/v5"
+	"github.com/unrud/joystick-monitor/screensaver"
+	"github.com/unrud/joystick-monitor/screensaver/screensavertest"
+	"reflect"
+	"testing"
+)
+
+const (
+	testName   = "test-app"
+	testReason = "test reason"
+)
+
+var fakeServices = map[string]func(t testing.TB, session, system *screensavertest.Bus) *screensavertest.FakeService{
+	"gnome": func(t testing.TB, session, system *screensavertest.Bus) *screensavertest.FakeService {
+		return screensavertest.StartFakeGnomeSessionManager(t, session)
+	},
+	"kde": func(t testing.TB, session, system *screensavertest.Bus) *screensavertest.FakeService {
+		return screensavertest.StartFakeKdePowerManagement(t, session)
+	},
+	"freedesktop": func(t testing.TB, session, system *screensavertest.Bus) *screensavertest.FakeService {
+		return screensavertest.StartFakeScreenSaver(t, session)
+	},
+	"portal": func(t testing.TB, session, system *screensavertest.Bus) *screensavertest.FakeService {
+		return screensavertest.StartFakePortal(t, session)
+	},
+	"logind": func(t testing.TB, session, system *screensavertest.Bus) *screensavertest.FakeService {
+		return screensavertest.StartFakeLogind(t, system)
+	},
+}
+
+func startBuses(t *testing.T) (session, system *screensavertest.Bus) {
+	return screensavertest.StartSessionBus(t), screensavertest.StartSystemBus(t)
+}
+
+func newInhibitor(t *testing.T, backends ...string) screensaver.Inhibitor {
+	inhibitor, err := screensaver.NewInhibitor(backends, testName, testReason, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { inhibitor.Close() })
+	return inhibitor
+}
+
+// Inhibitions bound to file descriptors are released asynchronously
+func expectInhibited(t *testing.T, service *screensavertest.FakeService, n int) {
+	t.Helper()
+	if !service.WaitInhibited(n) {
+		t.Fatalf("inhibited %d times, expected %d", service.Inhibited(), n)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	for _, backend := range screensaver.BackendNames() {
+		t.Run(backend, func(t *testing.T) {
+			session, system := startBuses(t)
+			service := fakeServices[backend](t, session, system)
+			inhibitor := newInhibitor(t, backend)
+			for i := 0; i < 2; i++ {
+				if err := inhibitor.Inhibit(""); err != nil {
+					t.Fatal(err)
+				}
+				expectInhibited(t, service, 1)
+				if err := inhibitor.Inhibit(""); err == nil {
+					t.Fatal("inhibited twice")
+				}
+				if err := inhibitor.Uninhibit(); err != nil {
+					t.Fatal(err)
+				}
+				expectInhibited(t, service, 0)
+				if err := inhibitor.Uninhibit(); err == nil {
+					t.Fatal("uninhibited twice")
+				}
+			}
+			calls := service.Calls()
+			if len(calls) == 0 {
+				t.Fatal("no calls recorded")
+			}
+			reasonFound := false
+			for _, arg := range calls[0].Args {
+				if options, ok := arg.(map[string]dbus.Variant); ok {
+					arg = options["reason"].Value()
+				}
+				if arg == testReason {
+					reasonFound = true
+				}
+			}
+			if !reasonFound {
+				t.Errorf("reason missing in %v", calls[0])
+			}
+		})
+	}
+}
+
+func TestInhibitReason(t *testing.T) {
+	session, _ := startBuses(t)
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	inhibitor := newInhibitor(t, "freedesktop")
+	for _, reason := range []string{"SuperTuxKart (gamepad)", ""} {
+		if err := inhibitor.Inhibit(reason); err != nil {
+			t.Fatal(err)
+		}
+		if err := inhibitor.Uninhibit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := service.Calls()
+	if len(calls) != 4 || calls[0].Args[1] != "SuperTuxKart (gamepad)" || calls[2].Args[1] != testReason {
+		t.Errorf("unexpected calls %v", calls)
+	}
+}
+
+func TestInhibitorCloseReleases(t *testing.T) {
+	session, system := startBuses(t)
+	service := fakeServices["logind"](t, session, system)
+	inhibitor, err := screensaver.NewInhibitor([]string{"logind"}, testName, testReason, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	if calls := service.Calls(); calls[0].Args[0] != "idle:sleep" {
+		t.Errorf("unexpected inhibit call %v", calls[0])
+	}
+	if err := inhibitor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectInhibited(t, service, 0)
+}
+
+func TestZeroCookie(t *testing.T) {
+	session, _ := startBuses(t)
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	service.SetZeroCookie(true)
+	inhibitor := newInhibitor(t, "freedesktop")
+	if err := inhibitor.Inhibit(""); err == nil {
+		t.Fatal("zero cookie accepted")
+	}
+	service.SetZeroCookie(false)
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	expectInhibited(t, service, 1)
+}
+
+func TestServiceError(t *testing.T) {
+	session, _ := startBuses(t)
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	service.SetError("org.freedesktop.DBus.Error.Failed")
+	inhibitor := newInhibitor(t, "freedesktop")
+	if err := inhibitor.Inhibit(""); err == nil {
+		t.Fatal("error not returned")
+	}
+	service.SetError("")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	service.SetError("org.freedesktop.DBus.Error.Failed")
+	if err := inhibitor.Uninhibit(); err == nil {
+		t.Fatal("error not returned")
+	}
+	// The stale inhibition is released before the next inhibit
+	if err := inhibitor.Inhibit(""); err == nil {
+		t.Fatal("error not returned")
+	}
+	expectInhibited(t, service, 1)
+	service.SetError("")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	expectInhibited(t, service, 1)
+	if err := inhibitor.Uninhibit(); err != nil {
+		t.Fatal(err)
+	}
+	expectInhibited(t, service, 0)
+}
+
+func TestServiceRestart(t *testing.T) {
+	session, _ := startBuses(t)
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	inhibitor := newInhibitor(t, "freedesktop")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	service.Restart(t)
+	if !service.WaitInhibited(1) {
+		t.Fatal("inhibit not reissued")
+	}
+	if err := inhibitor.Uninhibit(); err != nil {
+		t.Fatal(err)
+	}
+	expectInhibited(t, service, 0)
+}
+
+func TestServiceStopped(t *testing.T) {
+	session, _ := startBuses(t)
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	inhibitor := newInhibitor(t, "freedesktop")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	service.Stop()
+	if err := inhibitor.Uninhibit(); err != nil {
+		t.Fatal(err)
+	}
+	service.Start(t)
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	if !service.WaitInhibited(1) {
+		t.Fatal("not inhibited")
+	}
+}
+
+func TestServiceAppears(t *testing.T) {
+	session, _ := startBuses(t)
+	inhibitor := newInhibitor(t, "freedesktop")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	if !service.WaitInhibited(1) {
+		t.Fatal("inhibit not issued")
+	}
+}
+
+func TestLogindRestart(t *testing.T) {
+	_, system := startBuses(t)
+	service := screensavertest.StartFakeLogind(t, system)
+	inhibitor := newInhibitor(t, "logind")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	service.Restart(t)
+	if err := inhibitor.Uninhibit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(service.Calls()); n != 1 {
+		t.Fatalf("%d calls, expected 1", n)
+	}
+	expectInhibited(t, service, 0)
+}
+
+func TestBusRestart(t *testing.T) {
+	session, _ := startBuses(t)
+	service := screensavertest.StartFakeScreenSaver(t, session)
+	inhibitor := newInhibitor(t, "freedesktop")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	session.Restart(t)
+	service.Stop()
+	service.Start(t)
+	if !service.WaitInhibited(1) {
+		t.Fatal("inhibit not reissued")
+	}
+}
+
+func TestDetectBackends(t *testing.T) {
+	session, system := startBuses(t)
+	for _, backend := range []string{"logind", "freedesktop", "gnome"} {
+		fakeServices[backend](t, session, system)
+	}
+	detected, err := screensaver.DetectBackends()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"gnome", "freedesktop", "logind"}; !reflect.DeepEqual(detected, expected) {
+		t.Errorf("detected %v, expected %v", detected, expected)
+	}
+	for _, test := range []struct {
+		names, expected []string
+	}{
+		{[]string{"auto"}, []string{"gnome"}},
+		{[]string{"all"}, []string{"gnome", "freedesktop", "logind"}},
+		{[]string{"logind", "all"}, []string{"logind", "gnome", "freedesktop"}},
+		{[]string{"kde"}, []string{"kde"}},
+	} {
+		resolved, err := screensaver.ResolveBackends(test.names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(resolved, test.expected) {
+			t.Errorf("resolved %v to %v, expected %v", test.names, resolved, test.expected)
+		}
+	}
+	if _, err := screensaver.ResolveBackends([]string{"unknown"}); err == nil {
+		t.Error("unknown backend accepted")
+	}
+}
+
+func TestNoBackends(t *testing.T) {
+	startBuses(t)
+	if _, err := screensaver.ResolveBackends([]string{"auto"}); err == nil {
+		t.Error("no error without backends")
+	}
+}
+
+func TestMultiInhibitor(t *testing.T) {
+	session, system := startBuses(t)
+	screenSaver := screensavertest.StartFakeScreenSaver(t, session)
+	logind := screensavertest.StartFakeLogind(t, system)
+	inhibitor := newInhibitor(t, "freedesktop", "logind")
+	if err := inhibitor.Inhibit(""); err != nil {
+		t.Fatal(err)
+	}
+	expectInhibited(t, screenSaver, 1)
+	expectInhibited(t, logind, 1)
+	screenSaver.SetError("org.freedesktop.DBus.Error.Failed")
+	if err := inhibitor.Uninhibit(); err == nil {
+		t.Fatal("error not returned")
+	}
+	expectInhibited(t, logind, 0)
+}
@@ -0,0 +1,83 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	kdePowerManagementDest  = "org.kde.Solid.PowerManagement"
+	kdeInterruptSession     = 1
+	kdeChangeScreenSettings = 4
+)
+
+type KdePowerManagement struct {
+	serviceInhibitor
+	name  string
+	types uint32
+
+	cookie uint32
+}
+
+func NewKdePowerManagement(name, reason string, suspend bool) (*KdePowerManagement, error) {
+	var types uint32 = kdeChangeScreenSettings
+	if suspend {
+		types |= kdeInterruptSession
+	}
+	s := &KdePowerManagement{name: name, types: types}
+	if err := s.start(connectSessionBus, kdePowerManagementDest, reason, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *KdePowerManagement) object(bus *dbus.Conn) dbus.BusObject {
+	return bus.Object(kdePowerManagementDest, "/org/kde/Solid/PowerManagement/PolicyAgent")
+}
+
+func (s *KdePowerManagement) inhibit(bus *dbus.Conn, reason string) error {
+	var cookie uint32
+	if err := s.object(bus).Call("org.kde.Solid.PowerManagement.PolicyAgent.AddInhibition", 0, s.types, s.name, reason).Store(&cookie); err != nil {
+		return err
+	}
+	if cookie == 0 {
+		return fmt.Errorf("invalid cookie (%d) received", cookie)
+	}
+	s.cookie = cookie
+	return nil
+}
+
+func (s *KdePowerManagement) uninhibit(bus *dbus.Conn) error {
+	if s.cookie == 0 {
+		return nil
+	}
+	if err := s.object(bus).Call("org.kde.Solid.PowerManagement.PolicyAgent.ReleaseInhibition", 0, s.cookie).Store(); err != nil {
+		return err
+	}
+	s.cookie = 0
+	return nil
+}
+
+func (s *KdePowerManagement) reset() bool {
+	s.cookie = 0
+	return true
+}
@@ -0,0 +1,72 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+import (
+	"github.com/godbus/dbus/v5"
+	"syscall"
+)
+
+const logindDest = "org.freedesktop.login1"
+
+type Logind struct {
+	serviceInhibitor
+	name string
+	what string
+
+	fd int
+}
+
+func NewLogind(name, reason string, sleep bool) (*Logind, error) {
+	what := "idle"
+	if sleep {
+		what += ":sleep"
+	}
+	s := &Logind{name: name, what: what, fd: -1}
+	if err := s.start(connectSystemBus, logindDest, reason, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Logind) inhibit(bus *dbus.Conn, reason string) error {
+	var fd dbus.UnixFD
+	if err := bus.Object(logindDest, "/org/freedesktop/login1").Call("org.freedesktop.login1.Manager.Inhibit", 0, s.what, s.name, reason, "block").Store(&fd); err != nil {
+		return err
+	}
+	syscall.CloseOnExec(int(fd))
+	s.fd = int(fd)
+	return nil
+}
+
+func (s *Logind) uninhibit(bus *dbus.Conn) error {
+	if s.fd == -1 {
+		return nil
+	}
+	fd := s.fd
+	s.fd = -1
+	return syscall.Close(fd)
+}
+
+// The inhibitor file descriptor stays valid if logind restarts or the
+// connection is lost.
+func (s *Logind) reset() bool {
+	return s.fd == -1
+}
@@ -0,0 +1,52 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+type MultiInhibitor []Inhibitor
+
+func (m MultiInhibitor) Inhibit(reason string) error {
+	for i, inhibitor := range m {
+		if err := inhibitor.Inhibit(reason); err != nil {
+			for _, inhibitor := range m[:i] {
+				inhibitor.Uninhibit()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiInhibitor) Uninhibit() (err error) {
+	for _, inhibitor := range m {
+		if tempErr := inhibitor.Uninhibit(); err == nil {
+			err = tempErr
+		}
+	}
+	return
+}
+
+func (m MultiInhibitor) Close() (err error) {
+	for _, inhibitor := range m {
+		if tempErr := inhibitor.Close(); err == nil {
+			err = tempErr
+		}
+	}
+	return
+}
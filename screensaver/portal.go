@@ -0,0 +1,75 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	portalDest           = "org.freedesktop.portal.Desktop"
+	portalInhibitSuspend = 4
+	portalInhibitIdle    = 8
+)
+
+type Portal struct {
+	serviceInhibitor
+	flags uint32
+
+	handle dbus.ObjectPath
+}
+
+func NewPortal(reason string, suspend bool) (*Portal, error) {
+	var flags uint32 = portalInhibitIdle
+	if suspend {
+		flags |= portalInhibitSuspend
+	}
+	s := &Portal{flags: flags}
+	if err := s.start(connectSessionBus, portalDest, reason, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Portal) inhibit(bus *dbus.Conn, reason string) error {
+	options := map[string]dbus.Variant{"reason": dbus.MakeVariant(reason)}
+	var handle dbus.ObjectPath
+	if err := bus.Object(portalDest, "/org/freedesktop/portal/desktop").Call("org.freedesktop.portal.Inhibit.Inhibit", 0, "", s.flags, options).Store(&handle); err != nil {
+		return err
+	}
+	s.handle = handle
+	return nil
+}
+
+func (s *Portal) uninhibit(bus *dbus.Conn) error {
+	if s.handle == "" {
+		return nil
+	}
+	if err := bus.Object(portalDest, s.handle).Call("org.freedesktop.portal.Request.Close", 0).Store(); err != nil {
+		return err
+	}
+	s.handle = ""
+	return nil
+}
+
+func (s *Portal) reset() bool {
+	s.handle = ""
+	return true
+}
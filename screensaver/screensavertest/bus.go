@@ -0,0 +1,127 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package screensavertest provides a private D-Bus daemon and fake inhibitor
+// services for tests.
+package screensavertest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>%v</type>
+  <listen>unix:path=%v</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+type Bus struct {
+	Address    string
+	configPath string
+	socketPath string
+	cmd        *exec.Cmd
+}
+
+// StartSessionBus starts a private bus and sets DBUS_SESSION_BUS_ADDRESS.
+// The test is skipped if dbus-daemon is not installed.
+func StartSessionBus(t testing.TB) *Bus {
+	bus := startBus(t, "session")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", bus.Address)
+	return bus
+}
+
+// StartSystemBus starts a private bus and sets DBUS_SYSTEM_BUS_ADDRESS.
+// The test is skipped if dbus-daemon is not installed.
+func StartSystemBus(t testing.TB) *Bus {
+	bus := startBus(t, "system")
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", bus.Address)
+	return bus
+}
+
+func startBus(t testing.TB, busType string) *Bus {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	dir := t.TempDir()
+	bus := &Bus{
+		configPath: filepath.Join(dir, "bus.conf"),
+		socketPath: filepath.Join(dir, "bus"),
+	}
+	if err := os.WriteFile(bus.configPath, []byte(fmt.Sprintf(busConfig, busType, bus.socketPath)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(bus.Stop)
+	return bus
+}
+
+func (b *Bus) start() error {
+	os.Remove(b.socketPath)
+	cmd := exec.Command("dbus-daemon", "--config-file="+b.configPath, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// The address is printed when the bus is ready
+	if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("dbus-daemon: %w", err)
+	}
+	// Without GUID, the address stays valid when the bus is restarted
+	b.Address = "unix:path=" + b.socketPath
+	b.cmd = cmd
+	return nil
+}
+
+// Stop terminates the bus, all connections are closed.
+func (b *Bus) Stop() {
+	if b.cmd == nil {
+		return
+	}
+	b.cmd.Process.Kill()
+	b.cmd.Wait()
+	b.cmd = nil
+}
+
+// Restart stops the bus and starts it again with the same address.
+func (b *Bus) Restart(t testing.TB) {
+	b.Stop()
+	if err := b.start(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,344 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensavertest
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+type fakeBackend struct {
+	name    string
+	path    dbus.ObjectPath
+	iface   string
+	methods func(f *FakeService) map[string]interface{}
+}
+
+var (
+	fakeScreenSaver = fakeBackend{
+		"org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver", "org.freedesktop.ScreenSaver",
+		func(f *FakeService) map[string]interface{} {
+			return map[string]interface{}{
+				"Inhibit": func(name, reason string) (uint32, *dbus.Error) {
+					return f.addCookie("Inhibit", name, reason)
+				},
+				"UnInhibit": func(cookie uint32) *dbus.Error {
+					return f.removeCookie("UnInhibit", cookie)
+				},
+			}
+		},
+	}
+	fakeGnomeSessionManager = fakeBackend{
+		"org.gnome.SessionManager", "/org/gnome/SessionManager", "org.gnome.SessionManager",
+		func(f *FakeService) map[string]interface{} {
+			return map[string]interface{}{
+				"Inhibit": func(name string, xid uint32, reason string, flags uint32) (uint32, *dbus.Error) {
+					return f.addCookie("Inhibit", name, xid, reason, flags)
+				},
+				"Uninhibit": func(cookie uint32) *dbus.Error {
+					return f.removeCookie("Uninhibit", cookie)
+				},
+			}
+		},
+	}
+	fakeKdePowerManagement = fakeBackend{
+		"org.kde.Solid.PowerManagement", "/org/kde/Solid/PowerManagement/PolicyAgent", "org.kde.Solid.PowerManagement.PolicyAgent",
+		func(f *FakeService) map[string]interface{} {
+			return map[string]interface{}{
+				"AddInhibition": func(types uint32, name, reason string) (uint32, *dbus.Error) {
+					return f.addCookie("AddInhibition", types, name, reason)
+				},
+				"ReleaseInhibition": func(cookie uint32) *dbus.Error {
+					return f.removeCookie("ReleaseInhibition", cookie)
+				},
+			}
+		},
+	}
+	fakePortal = fakeBackend{
+		"org.freedesktop.portal.Desktop", "/org/freedesktop/portal/desktop", "org.freedesktop.portal.Inhibit",
+		func(f *FakeService) map[string]interface{} {
+			return map[string]interface{}{
+				"Inhibit": func(window string, flags uint32, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+					return f.addRequest("Inhibit", window, flags, options)
+				},
+			}
+		},
+	}
+	fakeLogind = fakeBackend{
+		"org.freedesktop.login1", "/org/freedesktop/login1", "org.freedesktop.login1.Manager",
+		func(f *FakeService) map[string]interface{} {
+			return map[string]interface{}{
+				"Inhibit": func(what, who, why, mode string) (dbus.UnixFD, *dbus.Error) {
+					return f.addPipe("Inhibit", what, who, why, mode)
+				},
+			}
+		},
+	}
+)
+
+// FakeService implements the inhibit methods of a service and records all
+// calls. Inhibitions of logind are bound to file descriptors and survive
+// restarts of the service.
+type FakeService struct {
+	bus     *Bus
+	backend fakeBackend
+
+	mutex      sync.Mutex
+	conn       *dbus.Conn
+	calls      []Call
+	errorName  string
+	zeroCookie bool
+	lastCookie uint32
+	cookies    map[uint32]struct{}
+	requests   map[dbus.ObjectPath]struct{}
+	pipes      []int
+	sentFds    []int
+}
+
+func StartFakeScreenSaver(t testing.TB, bus *Bus) *FakeService {
+	return startFakeService(t, bus, fakeScreenSaver)
+}
+
+func StartFakeGnomeSessionManager(t testing.TB, bus *Bus) *FakeService {
+	return startFakeService(t, bus, fakeGnomeSessionManager)
+}
+
+func StartFakeKdePowerManagement(t testing.TB, bus *Bus) *FakeService {
+	return startFakeService(t, bus, fakeKdePowerManagement)
+}
+
+func StartFakePortal(t testing.TB, bus *Bus) *FakeService {
+	return startFakeService(t, bus, fakePortal)
+}
+
+func StartFakeLogind(t testing.TB, bus *Bus) *FakeService {
+	return startFakeService(t, bus, fakeLogind)
+}
+
+func startFakeService(t testing.TB, bus *Bus, backend fakeBackend) *FakeService {
+	f := &FakeService{
+		bus:      bus,
+		backend:  backend,
+		cookies:  make(map[uint32]struct{}),
+		requests: make(map[dbus.ObjectPath]struct{}),
+	}
+	f.Start(t)
+	t.Cleanup(func() {
+		f.Stop()
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.closePipes()
+	})
+	return f
+}
+
+// Start connects the service to the bus, if it is not running.
+func (f *FakeService) Start(t testing.TB) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.conn != nil {
+		return
+	}
+	conn, err := dbus.Connect(f.bus.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ExportMethodTable(f.backend.methods(f), f.backend.path, f.backend.iface); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(f.backend.name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		t.Fatalf("name %v already taken", f.backend.name)
+	}
+	f.conn = conn
+}
+
+// Stop disconnects the service from the bus and drops all inhibitions that
+// are not bound to file descriptors.
+func (f *FakeService) Stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.conn == nil {
+		return
+	}
+	f.conn.Close()
+	f.conn = nil
+	f.cookies = make(map[uint32]struct{})
+	f.requests = make(map[dbus.ObjectPath]struct{})
+}
+
+// Restart replaces the service with a new owner.
+func (f *FakeService) Restart(t testing.TB) {
+	f.Stop()
+	f.Start(t)
+}
+
+// SetError makes all following calls fail with the D-Bus error name, an empty
+// name disables errors.
+func (f *FakeService) SetError(name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.errorName = name
+}
+
+// SetZeroCookie makes all following inhibit calls return the invalid cookie 0.
+func (f *FakeService) SetZeroCookie(zeroCookie bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.zeroCookie = zeroCookie
+}
+
+func (f *FakeService) Calls() []Call {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Call{}, f.calls...)
+}
+
+// Inhibited returns the number of active inhibitions.
+func (f *FakeService) Inhibited() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// The replies were sent, when the caller checks the state
+	for _, fd := range f.sentFds {
+		syscall.Close(fd)
+	}
+	f.sentFds = nil
+	var pipes []int
+	for _, fd := range f.pipes {
+		var buf [1]byte
+		if n, _ := syscall.Read(fd, buf[:]); n == 0 {
+			syscall.Close(fd)
+			continue
+		}
+		pipes = append(pipes, fd)
+	}
+	f.pipes = pipes
+	return len(f.cookies) + len(f.requests) + len(f.pipes)
+}
+
+// WaitInhibited waits until the number of active inhibitions is n.
+func (f *FakeService) WaitInhibited(n int) bool {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if f.Inhibited() == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FakeService) record(method string, args ...interface{}) *dbus.Error {
+	f.calls = append(f.calls, Call{method, args})
+	if f.errorName != "" {
+		return dbus.NewError(f.errorName, []interface{}{"simulated error"})
+	}
+	return nil
+}
+
+func (f *FakeService) addCookie(method string, args ...interface{}) (uint32, *dbus.Error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.record(method, args...); err != nil {
+		return 0, err
+	}
+	if f.zeroCookie {
+		return 0, nil
+	}
+	f.lastCookie++
+	f.cookies[f.lastCookie] = struct{}{}
+	return f.lastCookie, nil
+}
+
+func (f *FakeService) removeCookie(method string, cookie uint32) *dbus.Error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.record(method, cookie); err != nil {
+		return err
+	}
+	if _, found := f.cookies[cookie]; !found {
+		return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []interface{}{"invalid cookie"})
+	}
+	delete(f.cookies, cookie)
+	return nil
+}
+
+func (f *FakeService) addRequest(method string, args ...interface{}) (dbus.ObjectPath, *dbus.Error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.record(method, args...); err != nil {
+		return "", err
+	}
+	f.lastCookie++
+	handle := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/portal/desktop/request/fake/t%d", f.lastCookie))
+	conn := f.conn
+	if err := conn.ExportMethodTable(map[string]interface{}{
+		"Close": func() *dbus.Error {
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+			if err := f.record("Close", handle); err != nil {
+				return err
+			}
+			delete(f.requests, handle)
+			conn.Export(nil, handle, "org.freedesktop.portal.Request")
+			return nil
+		},
+	}, handle, "org.freedesktop.portal.Request"); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	f.requests[handle] = struct{}{}
+	return handle, nil
+}
+
+func (f *FakeService) addPipe(method string, args ...interface{}) (dbus.UnixFD, *dbus.Error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.record(method, args...); err != nil {
+		return -1, err
+	}
+	var fds [2]int
+	if err := syscall.Pipe2(fds[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		return -1, dbus.MakeFailedError(err)
+	}
+	f.pipes = append(f.pipes, fds[0])
+	f.sentFds = append(f.sentFds, fds[1])
+	return dbus.UnixFD(fds[1]), nil
+}
+
+func (f *FakeService) closePipes() {
+	for _, fd := range append(f.pipes, f.sentFds...) {
+		syscall.Close(fd)
+	}
+	f.pipes = nil
+	f.sentFds = nil
+}
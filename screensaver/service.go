@@ -0,0 +1,268 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package screensaver
+
+import (
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+)
+
+type serviceBackend interface {
+	inhibit(bus *dbus.Conn, reason string) error
+	// uninhibit must not use bus if nothing is inhibited
+	uninhibit(bus *dbus.Conn) error
+	// reset is called after the service or the connection went away and
+	// returns whether the inhibition must be reissued
+	reset() bool
+}
+
+// serviceInhibitor tracks the owner of a D-Bus service, reconnects to the bus
+// and reissues the inhibition of its backend if necessary.
+type serviceInhibitor struct {
+	connect func() (*dbus.Conn, error)
+	service string
+	backend serviceBackend
+	// Used if Inhibit is called without reason
+	defaultReason string
+
+	mutex     sync.Mutex
+	reason    string
+	bus       *dbus.Conn
+	owner     string
+	inhibited bool
+	closed    bool
+	done      chan struct{}
+}
+
+func isServiceMissing(err error) bool {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" ||
+			dbusErr.Name == "org.freedesktop.DBus.Error.NameHasNoOwner"
+	}
+	return false
+}
+
+func (s *serviceInhibitor) start(connect func() (*dbus.Conn, error), service, defaultReason string, backend serviceBackend) error {
+	s.connect = connect
+	s.service = service
+	s.defaultReason = defaultReason
+	s.backend = backend
+	s.done = make(chan struct{})
+	bus, signals, err := s.dial()
+	if err != nil {
+		return err
+	}
+	s.bus = bus
+	s.owner = s.nameOwner()
+	go s.watch(signals)
+	return nil
+}
+
+func (s *serviceInhibitor) dial() (*dbus.Conn, chan *dbus.Signal, error) {
+	bus, err := s.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := bus.AddMatchSignal(
+		dbus.WithMatchSender("org.freedesktop.DBus"),
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, s.service),
+	); err != nil {
+		bus.Close()
+		return nil, nil, err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	bus.Signal(signals)
+	return bus, signals, nil
+}
+
+func (s *serviceInhibitor) nameOwner() string {
+	var owner string
+	if err := s.bus.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, s.service).Store(&owner); err != nil {
+		return ""
+	}
+	return owner
+}
+
+func (s *serviceInhibitor) watch(signals chan *dbus.Signal) {
+	for {
+		for signal := range signals {
+			if signal.Name != "org.freedesktop.DBus.NameOwnerChanged" || len(signal.Body) != 3 {
+				continue
+			}
+			if name, _ := signal.Body[0].(string); name != s.service {
+				continue
+			}
+			newOwner, _ := signal.Body[2].(string)
+			s.ownerChanged(newOwner)
+		}
+		if signals = s.reconnect(); signals == nil {
+			return
+		}
+	}
+}
+
+func (s *serviceInhibitor) ownerChanged(newOwner string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed || newOwner == s.owner {
+		return
+	}
+	s.owner = newOwner
+	if !s.backend.reset() || !s.inhibited || newOwner == "" {
+		return
+	}
+	log.Printf("%v: owner changed, reissuing inhibit\n", s.service)
+	if err := s.reinhibit(); err != nil {
+		log.Printf("%v: inhibit: %v\n", s.service, err)
+	}
+}
+
+func (s *serviceInhibitor) reconnect() chan *dbus.Signal {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.bus.Close()
+	s.bus = nil
+	s.owner = ""
+	s.backend.reset()
+	s.mutex.Unlock()
+	log.Printf("%v: connection lost\n", s.service)
+	for interval := minReconnectInterval; ; {
+		select {
+		case <-s.done:
+			return nil
+		case <-time.After(interval):
+		}
+		bus, signals, err := s.dial()
+		if err != nil {
+			log.Printf("%v: reconnect: %v\n", s.service, err)
+			if interval *= 2; interval > maxReconnectInterval {
+				interval = maxReconnectInterval
+			}
+			continue
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.closed {
+			bus.Close()
+			return nil
+		}
+		s.bus = bus
+		s.owner = s.nameOwner()
+		log.Printf("%v: reconnected\n", s.service)
+		if s.backend.reset() && s.inhibited {
+			if err := s.reinhibit(); err != nil {
+				log.Printf("%v: inhibit: %v\n", s.service, err)
+			}
+		}
+		return signals
+	}
+}
+
+// reinhibit must be called with the mutex held. If the service is missing,
+// the inhibition is reissued when it appears.
+func (s *serviceInhibitor) reinhibit() error {
+	if err := s.backend.inhibit(s.bus, s.reason); err != nil {
+		if isServiceMissing(err) {
+			return nil
+		}
+		return err
+	}
+	if s.owner == "" {
+		// The service was activated by the call
+		s.owner = s.nameOwner()
+	}
+	return nil
+}
+
+func (s *serviceInhibitor) Inhibit(reason string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.inhibited {
+		return errors.New(s.service + " already inhibited")
+	}
+	if reason == "" {
+		reason = s.defaultReason
+	}
+	s.reason = reason
+	if s.bus != nil {
+		// The inhibition of a failed uninhibit must be released before it's
+		// replaced
+		if err := s.backend.uninhibit(s.bus); err != nil {
+			if !isServiceMissing(err) {
+				return err
+			}
+			s.backend.reset()
+		}
+		if err := s.reinhibit(); err != nil {
+			return err
+		}
+	}
+	s.inhibited = true
+	return nil
+}
+
+func (s *serviceInhibitor) Uninhibit() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.inhibited {
+		return errors.New(s.service + " not inhibited")
+	}
+	s.inhibited = false
+	if err := s.backend.uninhibit(s.bus); err != nil {
+		if isServiceMissing(err) {
+			s.backend.reset()
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *serviceInhibitor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	if s.inhibited {
+		s.inhibited = false
+		s.backend.uninhibit(s.bus)
+	}
+	if s.bus == nil {
+		return nil
+	}
+	return s.bus.Close()
+}
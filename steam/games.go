@@ -0,0 +1,143 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package steam
+
+import (
+	"fmt"
+	"github.com/unrud/joystick-monitor/processes"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ReaperComm is the name of the processes that launch Steam games
+const ReaperComm = "reaper"
+
+// Game is a game that was started by the Steam client
+type Game struct {
+	AppID int
+	Name  string
+	// Launches the game with the command line "reaper SteamLaunch AppId=N -- ..."
+	Reaper *processes.Process
+}
+
+func parseReaperCmdline(cmdline []string) (appID int, found bool) {
+	if len(cmdline) == 0 || path.Base(cmdline[0]) != "reaper" {
+		return 0, false
+	}
+	steamLaunch := false
+	for _, arg := range cmdline[1:] {
+		if arg == "--" {
+			break
+		}
+		if arg == "SteamLaunch" {
+			steamLaunch = true
+		}
+		if strings.HasPrefix(arg, "AppId=") {
+			appID, _ = strconv.Atoi(strings.TrimPrefix(arg, "AppId="))
+		}
+	}
+	if !steamLaunch || appID <= 0 {
+		return 0, false
+	}
+	return appID, true
+}
+
+// GameFinder finds the running Steam games and caches their names
+type GameFinder struct {
+	home  string
+	names map[int]string
+}
+
+// NewGameFinder creates the finder, the names are read from the app manifests
+// in the Steam libraries of home
+func NewGameFinder(home string) *GameFinder {
+	return &GameFinder{home: home, names: make(map[int]string)}
+}
+
+func (f *GameFinder) name(appID int) string {
+	name, found := f.names[appID]
+	if !found {
+		var err error
+		if name, err = AppName(f.home, appID); err != nil {
+			// Non-Steam games have no app manifests
+			name = fmt.Sprintf("Steam app %d", appID)
+		}
+		f.names[appID] = name
+	}
+	return name
+}
+
+// FindGames returns the running Steam games among the processes with the
+// name ReaperComm
+func (f *GameFinder) FindGames(reapers []*processes.Process) []*Game {
+	var games []*Game
+	for _, p := range reapers {
+		if appID, found := parseReaperCmdline(p.Cmdline); found {
+			games = append(games, &Game{AppID: appID, Name: f.name(appID), Reaper: p})
+		}
+	}
+	return games
+}
+
+// IsClient checks if the process is the Steam client, which keeps all
+// controllers open
+func IsClient(p *processes.Process) bool {
+	return p.Comm == "steam"
+}
+
+func gameOf(p *processes.Process, games []*Game) *Game {
+	for _, game := range games {
+		if p.Pid == game.Reaper.Pid || processes.IsDescendant(p, game.Reaper.Pid) {
+			return game
+		}
+	}
+	return nil
+}
+
+func latestGame(games []*Game) (latest *Game) {
+	for _, game := range games {
+		if latest == nil || game.Reaper.StartTime > latest.Reaper.StartTime {
+			latest = game
+		}
+	}
+	return latest
+}
+
+// Attribute returns the holders of a device with the games as application.
+// The Steam client is attributed to the latest game and only counts while
+// a game is running.
+func Attribute(holders []*processes.Process, games []*Game) (attributed []*processes.Process) {
+	for _, p := range holders {
+		game := gameOf(p, games)
+		if IsClient(p) {
+			if game = latestGame(games); game == nil {
+				continue
+			}
+		}
+		if game != nil {
+			gameProcess := *p
+			gameProcess.Application = game.Name
+			p = &gameProcess
+		}
+		attributed = append(attributed, p)
+	}
+	return attributed
+}
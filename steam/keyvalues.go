@@ -0,0 +1,140 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package steam
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keyValues is a node of Valve's KeyValues text format (used by .acf and .vdf
+// files). The values are strings or nested keyValues, keys are lower case.
+type keyValues map[string]interface{}
+
+func (kv keyValues) get(key string) keyValues {
+	value, _ := kv[strings.ToLower(key)].(keyValues)
+	return value
+}
+
+func (kv keyValues) getString(key string) string {
+	value, _ := kv[strings.ToLower(key)].(string)
+	return value
+}
+
+type keyValuesParser struct {
+	data string
+	pos  int
+}
+
+func parseKeyValues(data string) (keyValues, error) {
+	p := &keyValuesParser{data: data}
+	kv, err := p.parse(false)
+	if err != nil {
+		return nil, fmt.Errorf("offset %d: %w", p.pos, err)
+	}
+	return kv, nil
+}
+
+func (p *keyValuesParser) parse(nested bool) (keyValues, error) {
+	kv := make(keyValues)
+	for {
+		token, quoted, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if token == "" && !quoted {
+			if nested {
+				return nil, errors.New("unexpected end of data")
+			}
+			return kv, nil
+		}
+		if token == "}" && !quoted {
+			if !nested {
+				return nil, errors.New("unexpected }")
+			}
+			return kv, nil
+		}
+		key := strings.ToLower(token)
+		value, quoted, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case value == "{" && !quoted:
+			if kv[key], err = p.parse(true); err != nil {
+				return nil, err
+			}
+		case value == "" && !quoted, value == "}" && !quoted:
+			return nil, fmt.Errorf("missing value of %q", token)
+		default:
+			kv[key] = value
+		}
+	}
+}
+
+// next returns the next token, the token is empty at the end of the data
+func (p *keyValuesParser) next() (token string, quoted bool, err error) {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.pos++
+		case strings.HasPrefix(p.data[p.pos:], "//"):
+			if end := strings.IndexByte(p.data[p.pos:], '\n'); end >= 0 {
+				p.pos += end
+			} else {
+				p.pos = len(p.data)
+			}
+		case c == '{' || c == '}':
+			p.pos++
+			return string(c), false, nil
+		case c == '"':
+			var value strings.Builder
+			for p.pos++; p.pos < len(p.data); p.pos++ {
+				switch c := p.data[p.pos]; c {
+				case '"':
+					p.pos++
+					return value.String(), true, nil
+				case '\\':
+					if p.pos++; p.pos < len(p.data) {
+						switch c := p.data[p.pos]; c {
+						case 'n':
+							value.WriteByte('\n')
+						case 't':
+							value.WriteByte('\t')
+						default:
+							value.WriteByte(c)
+						}
+					}
+				default:
+					value.WriteByte(c)
+				}
+			}
+			return "", false, errors.New("unterminated string")
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && !strings.ContainsRune(" \t\r\n{}\"", rune(p.data[p.pos])) {
+				p.pos++
+			}
+			return p.data[start:p.pos], true, nil
+		}
+	}
+	return "", false, nil
+}
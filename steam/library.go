@@ -0,0 +1,98 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package steam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Installations of the Steam client relative to the home directory
+var clientDirs = []string{
+	".local/share/Steam",
+	".steam/steam",
+	".var/app/com.valvesoftware.Steam/.local/share/Steam",
+	"snap/steam/common/.local/share/Steam",
+}
+
+// libraryDirs returns the Steam libraries of the Steam installations in home
+func libraryDirs(home string) []string {
+	if home == "" {
+		return nil
+	}
+	var dirs []string
+	seen := make(map[string]struct{})
+	add := func(dir string) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if _, found := seen[dir]; !found {
+			seen[dir] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, clientDir := range clientDirs {
+		clientDir = filepath.Join(home, clientDir)
+		if _, err := os.Stat(filepath.Join(clientDir, "steamapps")); err != nil {
+			continue
+		}
+		add(clientDir)
+		data, err := os.ReadFile(filepath.Join(clientDir, "steamapps", "libraryfolders.vdf"))
+		if err != nil {
+			continue
+		}
+		folders, err := parseKeyValues(string(data))
+		if err != nil {
+			continue
+		}
+		for _, folder := range folders.get("libraryfolders") {
+			if folder, ok := folder.(keyValues); ok && folder.getString("path") != "" {
+				add(folder.getString("path"))
+			}
+		}
+	}
+	return dirs
+}
+
+// AppName returns the name of the app from the app manifests in the Steam
+// libraries of home
+func AppName(home string, appID int) (string, error) {
+	for _, dir := range libraryDirs(home) {
+		manifestPath := filepath.Join(dir, "steamapps", "appmanifest_"+strconv.Itoa(appID)+".acf")
+		data, err := os.ReadFile(manifestPath)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		manifest, err := parseKeyValues(string(data))
+		if err != nil {
+			return "", fmt.Errorf("%v: %w", manifestPath, err)
+		}
+		if name := manifest.get("AppState").getString("name"); name != "" {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("app manifest of %d: %w", appID, os.ErrNotExist)
+}
@@ -0,0 +1,160 @@
+/*
+ *    Copyright (c) 2023 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of joystick-monitor.
+ *
+ *    joystick-monitor is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    joystick-monitor is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with joystick-monitor.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package steam
+
+import (
+	"errors"
+	"github.com/unrud/joystick-monitor/processes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testManifest = `"AppState"
+{
+	"appid"		"620"
+	"name"		"Portal 2"
+	// Comment
+	"UserConfig"
+	{
+		"language"		"english"
+	}
+	"escaped"		"\"quoted\" \\ path"
+}
+`
+
+func TestParseKeyValues(t *testing.T) {
+	kv, err := parseKeyValues(testManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appState := kv.get("AppState")
+	if appState.getString("AppID") != "620" || appState.getString("name") != "Portal 2" ||
+		appState.get("UserConfig").getString("language") != "english" ||
+		appState.getString("escaped") != `"quoted" \ path` {
+		t.Errorf("unexpected key values %v", kv)
+	}
+	for _, data := range []string{"\"a\" {", "\"a\"", "}", "\"a\" \"b"} {
+		if _, err := parseKeyValues(data); err == nil {
+			t.Errorf("invalid data %q accepted", data)
+		}
+	}
+}
+
+func TestAppName(t *testing.T) {
+	home := t.TempDir()
+	library := filepath.Join(t.TempDir(), "SteamLibrary")
+	for dir, files := range map[string]map[string]string{
+		filepath.Join(home, ".local/share/Steam/steamapps"): {
+			"libraryfolders.vdf":  "\"libraryfolders\" { \"0\" { \"path\" \"" + filepath.Join(home, ".local/share/Steam") + "\" } \"1\" { \"path\" \"" + library + "\" } }",
+			"appmanifest_570.acf": "\"AppState\" { \"appid\" \"570\" \"name\" \"Dota 2\" }",
+		},
+		filepath.Join(library, "steamapps"): {
+			"appmanifest_620.acf": testManifest,
+		},
+	} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for appID, expected := range map[int]string{570: "Dota 2", 620: "Portal 2"} {
+		if name, err := AppName(home, appID); err != nil || name != expected {
+			t.Errorf("%d: got %q %v, expected %q", appID, name, err, expected)
+		}
+	}
+	if _, err := AppName(home, 730); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing app: got %v", err)
+	}
+}
+
+func TestParseReaperCmdline(t *testing.T) {
+	for _, test := range []struct {
+		cmdline  []string
+		expected int
+	}{
+		{[]string{"/home/user/.local/share/Steam/ubuntu12_32/reaper", "SteamLaunch", "AppId=620", "--", "/games/portal2.sh"}, 620},
+		{[]string{"reaper", "AppId=620"}, 0},
+		{[]string{"reaper", "SteamLaunch", "--", "game", "AppId=620"}, 0},
+		{[]string{"/usr/bin/game", "SteamLaunch", "AppId=620"}, 0},
+	} {
+		if appID, _ := parseReaperCmdline(test.cmdline); appID != test.expected {
+			t.Errorf("%v: got %v, expected %v", test.cmdline, appID, test.expected)
+		}
+	}
+}
+
+func TestFindGames(t *testing.T) {
+	home := t.TempDir()
+	manifestPath := filepath.Join(home, ".local/share/Steam/steamapps/appmanifest_620.acf")
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath, []byte(testManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reaper := &processes.Process{Pid: 200, PPid: 100, Comm: ReaperComm, Cmdline: []string{"reaper", "SteamLaunch", "AppId=620", "--", "portal2.sh"}}
+	reapers := []*processes.Process{
+		reaper,
+		{Pid: 300, PPid: 100, Comm: ReaperComm, Cmdline: []string{"/usr/bin/reaper", "--grim"}},
+	}
+	f := NewGameFinder(home)
+	games := f.FindGames(reapers)
+	if len(games) != 1 || games[0].AppID != 620 || games[0].Name != "Portal 2" || games[0].Reaper != reaper {
+		t.Fatalf("got %v", games)
+	}
+	// The names are cached
+	if err := os.Remove(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if games := f.FindGames(reapers); len(games) != 1 || games[0].Name != "Portal 2" {
+		t.Errorf("after removal of manifest: got %v", games)
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	client := &processes.Process{Pid: 100, Comm: "steam"}
+	game := &processes.Process{Pid: 300, PPid: 200, Comm: "portal2_linux"}
+	other := &processes.Process{Pid: 400, PPid: 1, Comm: "supertuxkart"}
+	if holders := Attribute([]*processes.Process{client, other}, nil); len(holders) != 1 || holders[0] != other {
+		t.Errorf("without games: got %v", holders)
+	}
+	games := []*Game{
+		{AppID: 570, Name: "Dota 2", Reaper: &processes.Process{Pid: 150, PPid: 100, StartTime: 1000}},
+		{AppID: 620, Name: "Portal 2", Reaper: &processes.Process{Pid: 200, PPid: 100, StartTime: 2000}},
+	}
+	// Games that read input through Steam Input don't hold devices
+	if holders := Attribute([]*processes.Process{client}, games[1:]); len(holders) != 1 ||
+		holders[0].Name() != "Portal 2" || holders[0].Pid != client.Pid {
+		t.Errorf("only client: got %v", holders)
+	}
+	holders := Attribute([]*processes.Process{client, game, other}, games)
+	if len(holders) != 3 || holders[0].Name() != "Portal 2" || holders[0].Pid != client.Pid ||
+		holders[1].Name() != "Portal 2" || holders[2] != other {
+		t.Errorf("with games: got %v", holders)
+	}
+	if client.Application != "" {
+		t.Error("holder modified")
+	}
+}